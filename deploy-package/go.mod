@@ -1,3 +0,0 @@
-module git.caffsoft.dev/caffeinated/hugo-contact
-
-go 1.24.2
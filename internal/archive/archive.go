@@ -0,0 +1,493 @@
+// Package archive stores accepted submissions in an embedded bbolt
+// database.
+package archive
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	defaultPath      = "/var/log/hugo-contact/submissions.db"
+	defaultRetention = 365
+	openTimeout      = 5 * time.Second
+
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Verdicts an administrator can assign to an archived submission.
+const (
+	VerdictSpam = "spam"
+	VerdictHam  = "ham"
+)
+
+// Results of the CAPTCHA check of an accepted submission.
+const (
+	CaptchaPassed   = "passed"
+	CaptchaFailOpen = "fail_open" // the provider was unavailable and the form fails open
+)
+
+var submissionsBucket = []byte("submissions")
+
+// ErrNotFound is returned for unknown submission IDs.
+var ErrNotFound = errors.New("submission not found")
+
+// ErrLocked is returned when another process holds the database open
+// without answering on its socket.
+var ErrLocked = errors.New("submission archive is in use by another process")
+
+// handles are the databases kept open by Open, by path, so that every Archive
+// of the process shares them, and the servers answering on their sockets.
+var handles = struct {
+	sync.Mutex
+	dbs     map[string]*bolt.DB
+	sockets map[string]*http.Server
+}{dbs: make(map[string]*bolt.DB), sockets: make(map[string]*http.Server)}
+
+// Submission is an accepted form submission as stored in the archive.
+type Submission struct {
+	ID             string              `json:"id"`
+	ReceivedAt     time.Time           `json:"received_at"`
+	FormID         string              `json:"form_id"`
+	Name           string              `json:"name"`
+	Email          string              `json:"email"`
+	Subject        string              `json:"subject"`
+	Message        string              `json:"message"`
+	Fields         map[string][]string `json:"fields"`
+	ClientIP       string              `json:"client_ip"`
+	UserAgent      string              `json:"user_agent"`
+	Origin         string              `json:"origin"`
+	Referer        string              `json:"referer"`
+	DeliveryStatus string              `json:"delivery_status"`
+	DeliveryError  string              `json:"delivery_error,omitempty"`
+	DeliveredAt    time.Time           `json:"delivered_at,omitzero"`
+	Verdict        string              `json:"verdict,omitempty"`
+	Captcha        *Captcha            `json:"captcha,omitempty"`
+}
+
+// Captcha records how a submission got past the CAPTCHA check.
+type Captcha struct {
+	Provider string   `json:"provider"`
+	Result   string   `json:"result"`
+	Score    *float64 `json:"score,omitempty"`
+	Hostname string   `json:"hostname,omitempty"`
+	Error    string   `json:"error,omitempty"` // why the provider was unavailable
+}
+
+// Filter selects archived submissions. Zero values match all.
+type Filter struct {
+	Since  time.Time
+	Until  time.Time
+	Email  string // case-insensitive substring of the sender address
+	Text   string // case-insensitive substring of name, subject or message
+	FormID string
+	Status string
+	Limit  int
+}
+
+func (f Filter) match(s *Submission) bool {
+	if !f.Since.IsZero() && s.ReceivedAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !s.ReceivedAt.Before(f.Until) {
+		return false
+	}
+	if f.Email != "" && !strings.Contains(strings.ToLower(s.Email), strings.ToLower(f.Email)) {
+		return false
+	}
+	if f.FormID != "" && s.FormID != f.FormID {
+		return false
+	}
+	if f.Status != "" && s.DeliveryStatus != f.Status {
+		return false
+	}
+	if f.Text != "" {
+		text := strings.ToLower(f.Text)
+		if !strings.Contains(strings.ToLower(s.Name), text) &&
+			!strings.Contains(strings.ToLower(s.Subject), text) &&
+			!strings.Contains(strings.ToLower(s.Message), text) {
+			return false
+		}
+	}
+	return true
+}
+
+// Archive stores accepted submissions in an embedded bbolt
+// database, keyed by a time-ordered ID. The server keeps the database open
+// with Open; otherwise it is opened for each operation. bbolt locks the file,
+// so while the server runs, Search, Get and Purge of other processes go
+// through its socket.
+type Archive struct {
+	path          string
+	retentionDays int
+}
+
+// New returns an archive configured from
+// SUBMISSION_ARCHIVE_PATH and SUBMISSION_RETENTION_DAYS.
+func New() *Archive {
+	path := os.Getenv("SUBMISSION_ARCHIVE_PATH")
+	if path == "" {
+		path = defaultPath
+	}
+
+	retentionDays := defaultRetention
+	if env := os.Getenv("SUBMISSION_RETENTION_DAYS"); env != "" {
+		if days, err := strconv.Atoi(env); err == nil && days >= 0 {
+			retentionDays = days
+		}
+	}
+
+	return &Archive{
+		path:          path,
+		retentionDays: retentionDays,
+	}
+}
+
+// Path returns the database file.
+func (a *Archive) Path() string { return a.path }
+
+// RetentionDays returns how long submissions are kept, 0 for ever.
+func (a *Archive) RetentionDays() int { return a.retentionDays }
+
+// Open opens the database for the lifetime of the process, until Close, and
+// answers other processes on SocketPath.
+func (a *Archive) Open() error {
+	handles.Lock()
+	defer handles.Unlock()
+
+	if handles.dbs[a.path] != nil {
+		return nil
+	}
+	db, err := a.openFile(false)
+	if err != nil {
+		return err
+	}
+	srv, err := a.listen()
+	if err != nil {
+		db.Close()
+		return err
+	}
+	handles.dbs[a.path] = db
+	handles.sockets[a.path] = srv
+	return nil
+}
+
+// Close closes the database opened by Open.
+func (a *Archive) Close() error {
+	handles.Lock()
+	defer handles.Unlock()
+
+	db := handles.dbs[a.path]
+	if db == nil {
+		return nil
+	}
+	delete(handles.dbs, a.path)
+	if srv := handles.sockets[a.path]; srv != nil {
+		delete(handles.sockets, a.path)
+		srv.Close()
+	}
+	return db.Close()
+}
+
+// open returns the database kept open by Open, or opens it for one
+// operation. The returned function releases it. A read-only open of a
+// database that does not exist yet returns nil.
+func (a *Archive) open(readOnly bool) (*bolt.DB, func(), error) {
+	handles.Lock()
+	db := handles.dbs[a.path]
+	handles.Unlock()
+	if db != nil {
+		return db, func() {}, nil
+	}
+
+	db, err := a.openFile(readOnly)
+	if err != nil || db == nil {
+		return nil, func() {}, err
+	}
+	return db, func() { db.Close() }, nil
+}
+
+func (a *Archive) openFile(readOnly bool) (*bolt.DB, error) {
+	if !readOnly {
+		if err := os.MkdirAll(filepath.Dir(a.path), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create archive directory: %w", err)
+		}
+	} else if _, err := os.Stat(a.path); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	db, err := bolt.Open(a.path, 0600, &bolt.Options{Timeout: openTimeout, ReadOnly: readOnly})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, ErrLocked
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open submission archive: %w", err)
+	}
+	return db, nil
+}
+
+func (a *Archive) update(fn func(b *bolt.Bucket) error) error {
+	db, release, err := a.open(false)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(submissionsBucket)
+		if err != nil {
+			return err
+		}
+		return fn(b)
+	})
+}
+
+// Store adds a submission and returns its ID.
+func (a *Archive) Store(sub Submission) (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	sub.ID = sub.ReceivedAt.UTC().Format("20060102-150405.000000") + "-" + hex.EncodeToString(suffix)
+
+	data, err := json.Marshal(sub)
+	if err != nil {
+		return "", err
+	}
+
+	err = a.update(func(b *bolt.Bucket) error {
+		return b.Put([]byte(sub.ID), data)
+	})
+	if err != nil {
+		return "", err
+	}
+	return sub.ID, nil
+}
+
+// SetDeliveryStatus records the outcome of delivering a submission.
+func (a *Archive) SetDeliveryStatus(id, status string, deliveryErr error) error {
+	_, err := a.modify(id, func(sub *Submission) {
+		sub.DeliveryStatus = status
+		sub.DeliveryError = ""
+		if deliveryErr != nil {
+			sub.DeliveryError = deliveryErr.Error()
+		}
+		if status == DeliveryDelivered {
+			sub.DeliveredAt = time.Now()
+		}
+	})
+	return err
+}
+
+// SetVerdict records an administrator's spam or ham verdict.
+func (a *Archive) SetVerdict(id, verdict string) (Submission, error) {
+	return a.modify(id, func(sub *Submission) {
+		sub.Verdict = verdict
+	})
+}
+
+// Get returns a single submission.
+func (a *Archive) Get(id string) (Submission, error) {
+	var sub Submission
+	if client := a.remote(); client != nil {
+		err := a.call(client, http.MethodGet, "/submissions/"+url.PathEscape(id), nil, &sub)
+		return sub, err
+	}
+	db, release, err := a.open(true)
+	if err != nil {
+		return sub, err
+	}
+	if db == nil {
+		return sub, ErrNotFound
+	}
+	defer release()
+
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(submissionsBucket)
+		if b == nil {
+			return ErrNotFound
+		}
+		data := b.Get([]byte(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, &sub)
+	})
+	return sub, err
+}
+
+func (a *Archive) modify(id string, fn func(sub *Submission)) (Submission, error) {
+	var sub Submission
+	err := a.update(func(b *bolt.Bucket) error {
+		data := b.Get([]byte(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		if err := json.Unmarshal(data, &sub); err != nil {
+			return err
+		}
+
+		fn(&sub)
+
+		data, err := json.Marshal(sub)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(id), data)
+	})
+	return sub, err
+}
+
+// Search returns matching submissions, newest first.
+func (a *Archive) Search(filter Filter) ([]Submission, error) {
+	if client := a.remote(); client != nil {
+		var subs []Submission
+		err := a.call(client, http.MethodPost, "/search", filter, &subs)
+		return subs, err
+	}
+	db, release, err := a.open(true)
+	if err != nil || db == nil {
+		return nil, err
+	}
+	defer release()
+
+	var subs []Submission
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(submissionsBucket)
+		if b == nil {
+			return nil
+		}
+
+		c := b.Cursor()
+		var k, v []byte
+		if filter.Until.IsZero() {
+			k, v = c.Last()
+		} else {
+			// IDs start with the UTC receive time, so seek just past Until
+			k, v = c.Seek([]byte(filter.Until.UTC().Format("20060102-150405.000000")))
+			if k == nil {
+				k, v = c.Last()
+			}
+		}
+
+		for ; k != nil; k, v = c.Prev() {
+			var sub Submission
+			if err := json.Unmarshal(v, &sub); err != nil {
+				continue // Skip malformed entries
+			}
+			if !filter.Since.IsZero() && sub.ReceivedAt.Before(filter.Since) {
+				break
+			}
+			if !filter.match(&sub) {
+				continue
+			}
+			subs = append(subs, sub)
+			if filter.Limit > 0 && len(subs) >= filter.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	return subs, err
+}
+
+// Purge deletes submissions received before the retention period and
+// returns how many were removed. A retention of 0 days keeps everything.
+func (a *Archive) Purge() (int, error) {
+	return a.purge(a.retentionDays)
+}
+
+func (a *Archive) purge(retentionDays int) (int, error) {
+	if retentionDays == 0 {
+		return 0, nil
+	}
+	if client := a.remote(); client != nil {
+		var removed int
+		err := a.call(client, http.MethodPost, "/purge?retention_days="+strconv.Itoa(retentionDays), nil, &removed)
+		return removed, err
+	}
+	if _, err := os.Stat(a.path); errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+
+	cutoff := []byte(time.Now().AddDate(0, 0, -retentionDays).UTC().Format("20060102-150405.000000"))
+	removed := 0
+	err := a.update(func(b *bolt.Bucket) error {
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k, cutoff) < 0; k, _ = c.Next() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// RunRetention purges expired submissions now and then once a day, in the
+// background.
+func (a *Archive) RunRetention(logger *slog.Logger) {
+	purge := func() {
+		removed, err := a.Purge()
+		if err != nil {
+			logger.Error("Failed to purge submission archive", slog.String("error", err.Error()))
+		} else if removed > 0 {
+			logger.Info("Purged expired submissions", slog.Int("removed", removed))
+		}
+	}
+
+	go func() {
+		purge()
+		for range time.Tick(24 * time.Hour) {
+			purge()
+		}
+	}()
+}
+
+// WriteCSV writes subs as CSV with a header row.
+func WriteCSV(w io.Writer, subs []Submission) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"id", "received_at", "form_id", "name", "email", "subject", "message",
+		"client_ip", "user_agent", "origin", "referer", "delivery_status", "delivery_error", "delivered_at"})
+	for _, s := range subs {
+		deliveredAt := ""
+		if !s.DeliveredAt.IsZero() {
+			deliveredAt = s.DeliveredAt.Format(time.RFC3339)
+		}
+		_ = cw.Write([]string{s.ID, s.ReceivedAt.Format(time.RFC3339), s.FormID, s.Name, s.Email, s.Subject, s.Message,
+			s.ClientIP, s.UserAgent, s.Origin, s.Referer, s.DeliveryStatus, s.DeliveryError, deliveredAt})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSONL writes subs as one JSON object per line.
+func WriteJSONL(w io.Writer, subs []Submission) error {
+	enc := json.NewEncoder(w)
+	for _, s := range subs {
+		if err := enc.Encode(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package archive
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSocket(t *testing.T) {
+	a := &Archive{path: filepath.Join(t.TempDir(), "submissions.db"), retentionDays: 30}
+	if err := a.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close() })
+
+	now := time.Now()
+	old, err := a.Store(Submission{ReceivedAt: now.AddDate(0, 0, -40), Email: "old@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recent, err := a.Store(Submission{ReceivedAt: now, Email: "ann@example.com", Subject: "Invoice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// what another process gets; within this one, Search and the others use
+	// the open database directly
+	client := socketClient(a.SocketPath())
+
+	var subs []Submission
+	if err := a.call(client, http.MethodPost, "/search", Filter{Text: "invoice"}, &subs); err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 1 || subs[0].ID != recent {
+		t.Errorf("search = %v, want %s", subs, recent)
+	}
+
+	var sub Submission
+	if err := a.call(client, http.MethodGet, "/submissions/"+old, nil, &sub); err != nil || sub.Email != "old@example.com" {
+		t.Errorf("get = %+v, %v", sub, err)
+	}
+	if err := a.call(client, http.MethodGet, "/submissions/nope", nil, &sub); !errors.Is(err, ErrNotFound) {
+		t.Errorf("get unknown = %v, want ErrNotFound", err)
+	}
+
+	var removed int
+	if err := a.call(client, http.MethodPost, "/purge?retention_days=30", nil, &removed); err != nil || removed != 1 {
+		t.Errorf("purge = %d, %v, want 1", removed, err)
+	}
+}
+
+func TestNoRemoteWithoutSocket(t *testing.T) {
+	a := &Archive{path: filepath.Join(t.TempDir(), "submissions.db")}
+	if _, err := a.Store(Submission{ReceivedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	db, err := a.openFile(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if a.remote() != nil {
+		t.Error("remote client without a socket")
+	}
+}
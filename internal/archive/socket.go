@@ -0,0 +1,157 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// While the server holds the database open, other processes on the host,
+// such as the submissions and digest commands run with docker exec, reach it
+// through a Unix socket next to the file. Only the owner of the database can
+// connect.
+
+const (
+	socketDialTimeout = time.Second
+	socketTimeout     = time.Minute
+)
+
+// SocketPath returns the socket the server answers on while it holds the
+// database open.
+func (a *Archive) SocketPath() string { return a.path + ".sock" }
+
+// listen serves Search, Get and Purge on the socket for other processes.
+func (a *Archive) listen() (*http.Server, error) {
+	path := a.SocketPath()
+	// the database lock is held, so a socket left behind is not in use
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove stale archive socket: %w", err)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on archive socket: %w", err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to restrict archive socket: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /search", a.serveSearch)
+	mux.HandleFunc("GET /submissions/{id}", a.serveGet)
+	mux.HandleFunc("POST /purge", a.servePurge)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: socketTimeout}
+	go srv.Serve(ln)
+	return srv, nil
+}
+
+func (a *Archive) serveSearch(w http.ResponseWriter, r *http.Request) {
+	var filter Filter
+	if err := json.NewDecoder(r.Body).Decode(&filter); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	subs, err := a.Search(filter)
+	writeSocketReply(w, subs, err)
+}
+
+func (a *Archive) serveGet(w http.ResponseWriter, r *http.Request) {
+	sub, err := a.Get(r.PathValue("id"))
+	writeSocketReply(w, sub, err)
+}
+
+func (a *Archive) servePurge(w http.ResponseWriter, r *http.Request) {
+	days, err := strconv.Atoi(r.URL.Query().Get("retention_days"))
+	if err != nil || days < 0 {
+		http.Error(w, "invalid retention_days", http.StatusBadRequest)
+		return
+	}
+	// the retention of the calling process, as if it had opened the file
+	removed, err := a.purge(days)
+	writeSocketReply(w, removed, err)
+}
+
+func writeSocketReply(w http.ResponseWriter, v interface{}, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+}
+
+// remote returns a client for the socket of a running server, or nil when
+// this process holds the database or no server answers.
+func (a *Archive) remote() *http.Client {
+	handles.Lock()
+	local := handles.dbs[a.path] != nil
+	handles.Unlock()
+	if local {
+		return nil
+	}
+
+	path := a.SocketPath()
+	conn, err := net.DialTimeout("unix", path, socketDialTimeout)
+	if err != nil {
+		return nil // not running, or a socket left behind by a crash
+	}
+	conn.Close()
+	return socketClient(path)
+}
+
+// socketClient returns a client that sends every request to the socket at
+// path.
+func socketClient(path string) *http.Client {
+	return &http.Client{
+		Timeout: socketTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		},
+	}
+}
+
+// call sends in as JSON to the server's socket and decodes the reply into
+// out.
+func (a *Archive) call(client *http.Client, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, "http://archive"+path, body)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach the server through %s: %w", a.SocketPath(), err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return json.NewDecoder(resp.Body).Decode(out)
+	case http.StatusNotFound:
+		return ErrNotFound
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("submission archive: %s", strings.TrimSpace(string(msg)))
+}
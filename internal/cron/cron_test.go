@@ -0,0 +1,110 @@
+package cron
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		zone string
+		from string
+		want string // empty for no activation
+	}{
+		{"every minute", "* * * * *", "UTC", "2026-10-18T10:07:30Z", "2026-10-18T10:08:00Z"},
+		{"strictly after", "0 * * * *", "UTC", "2026-10-18T10:00:00Z", "2026-10-18T11:00:00Z"},
+		{"step", "*/15 * * * *", "UTC", "2026-10-18T10:07:00Z", "2026-10-18T10:15:00Z"},
+		{"step from offset", "5/20 * * * *", "UTC", "2026-10-18T10:26:00Z", "2026-10-18T10:45:00Z"},
+		{"step in range", "0 8-18/4 * * *", "UTC", "2026-10-18T12:30:00Z", "2026-10-18T16:00:00Z"},
+		{"list", "0 6,18 * * *", "UTC", "2026-10-18T07:00:00Z", "2026-10-18T18:00:00Z"},
+		{"month names", "0 9 1 jan,jul *", "UTC", "2026-10-18T00:00:00Z", "2027-01-01T09:00:00Z"},
+		{"day names", "0 9 * * mon-fri", "UTC", "2026-10-17T10:00:00Z", "2026-10-19T09:00:00Z"},
+		{"sunday as 7", "0 0 * * 7", "UTC", "2026-10-18T01:00:00Z", "2026-10-25T00:00:00Z"},
+		{"macro", "@weekly", "UTC", "2026-10-18T00:00:00Z", "2026-10-25T00:00:00Z"},
+
+		// a restricted day of month and day of week are alternatives
+		{"dom or dow", "0 0 13 * fri", "UTC", "2026-10-18T00:00:00Z", "2026-10-23T00:00:00Z"},
+		{"dom or dow, dom first", "0 0 13 * fri", "UTC", "2026-11-07T00:00:00Z", "2026-11-13T00:00:00Z"},
+		{"dom only", "0 0 13 * *", "UTC", "2026-10-18T00:00:00Z", "2026-11-13T00:00:00Z"},
+		{"dow only", "0 0 * * fri", "UTC", "2026-10-18T00:00:00Z", "2026-10-23T00:00:00Z"},
+		{"never", "0 0 30 2 *", "UTC", "2026-10-18T00:00:00Z", ""},
+
+		// zones that are not a whole number of hours off UTC
+		{"kolkata", "0 9 * * *", "Asia/Kolkata", "2026-10-18T08:10:00+05:30", "2026-10-18T09:00:00+05:30"},
+		{"kolkata hourly", "0 * * * *", "Asia/Kolkata", "2026-10-18T10:10:00+05:30", "2026-10-18T11:00:00+05:30"},
+		{"kathmandu", "30 7 * * *", "Asia/Kathmandu", "2026-10-18T06:50:00+05:45", "2026-10-18T07:30:00+05:45"},
+
+		// the clocks go forward from 02:00 to 03:00 on 8 March
+		{"skipped by dst", "30 2 * * *", "America/New_York", "2026-03-08T00:00:00-05:00", "2026-03-09T02:30:00-04:00"},
+		{"after dst gap", "0 3 * * *", "America/New_York", "2026-03-08T01:30:00-05:00", "2026-03-08T03:00:00-04:00"},
+		{"hourly over dst gap", "0 * * * *", "America/New_York", "2026-03-08T01:30:00-05:00", "2026-03-08T03:00:00-04:00"},
+
+		// the clocks go forward from 00:00 to 01:00 on 6 September
+		{"midnight skipped by dst", "0 0 * * *", "America/Santiago", "2026-09-05T12:00:00-04:00", "2026-09-07T00:00:00-03:00"},
+		{"day starting after dst gap", "0 1 * * *", "America/Santiago", "2026-09-05T12:00:00-04:00", "2026-09-06T01:00:00-03:00"},
+
+		// the clocks go back from 02:00 to 01:00 on 1 November
+		{"repeated by dst", "30 1 * * *", "America/New_York", "2026-11-01T00:00:00-04:00", "2026-11-01T01:30:00-04:00"},
+		{"repeated fires once", "30 1 * * *", "America/New_York", "2026-11-01T01:30:00-04:00", "2026-11-02T01:30:00-05:00"},
+		{"after repeated hour", "0 2 * * *", "America/New_York", "2026-11-01T01:30:00-05:00", "2026-11-01T02:00:00-05:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.expr, mustLoad(t, tt.zone))
+			if err != nil {
+				t.Fatal(err)
+			}
+			from, err := time.Parse(time.RFC3339, tt.from)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := s.Next(from)
+			if tt.want == "" {
+				if !got.IsZero() {
+					t.Errorf("Next(%s) = %s, want none", tt.from, got.Format(time.RFC3339))
+				}
+				return
+			}
+			want, err := time.Parse(time.RFC3339, tt.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.from, got.Format(time.RFC3339), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * foo *",
+	} {
+		if _, err := Parse(expr, time.UTC); err == nil {
+			t.Errorf("Parse(%q) succeeded", expr)
+		}
+	}
+}
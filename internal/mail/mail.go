@@ -0,0 +1,163 @@
+// Package mail delivers messages through the configured SMTP server.
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("git.caffsoft.dev/caffeinated/hugo-contact/internal/mail")
+
+// ErrNotConfigured is returned when an SMTP setting is missing.
+var ErrNotConfigured = errors.New("missing required SMTP environment variables")
+
+// Config holds the SMTP settings.
+type Config struct {
+	Host      string
+	Port      string
+	Username  string
+	Password  string
+	Sender    string
+	Recipient string
+}
+
+// ConfigFromEnv reads SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD,
+// SENDER_EMAIL and RECIPIENT_EMAIL.
+func ConfigFromEnv() Config {
+	return Config{
+		Host:      os.Getenv("SMTP_HOST"),
+		Port:      os.Getenv("SMTP_PORT"),
+		Username:  os.Getenv("SMTP_USERNAME"),
+		Password:  os.Getenv("SMTP_PASSWORD"),
+		Sender:    os.Getenv("SENDER_EMAIL"),
+		Recipient: os.Getenv("RECIPIENT_EMAIL"),
+	}
+}
+
+// Validate reports a missing setting.
+func (c Config) Validate() error {
+	if c.Host == "" || c.Port == "" || c.Username == "" || c.Password == "" || c.Sender == "" || c.Recipient == "" {
+		return ErrNotConfigured
+	}
+	return nil
+}
+
+// Addr returns host:port of the SMTP server.
+func (c Config) Addr() string {
+	return net.JoinHostPort(c.Host, c.Port)
+}
+
+// Send delivers a complete message, headers included, from c.Sender to the
+// recipients, or to c.Recipient if none are given.
+func Send(ctx context.Context, c Config, msg []byte, to ...string) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if len(to) == 0 {
+		to = []string{c.Recipient}
+	}
+
+	client, err := Dial(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	_, span := tracer.Start(ctx, "smtp.data")
+	err = write(client, c.Sender, to, msg)
+	endSpan(span, err)
+	return err
+}
+
+// Dial connects, upgrades to TLS when offered and authenticates, like
+// smtp.SendMail, with a span for each phase. The caller closes the client.
+func Dial(ctx context.Context, c Config) (*smtp.Client, error) {
+	_, dial := tracer.Start(ctx, "smtp.dial",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.ServerAddress(c.Host)))
+	client, err := func() (*smtp.Client, error) {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", c.Addr())
+		if err != nil {
+			return nil, err
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.SetDeadline(deadline)
+		}
+		client, err := smtp.NewClient(conn, c.Host)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if err := client.Hello("localhost"); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("EHLO: %w", err)
+		}
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: c.Host}); err != nil {
+				client.Close()
+				return nil, fmt.Errorf("STARTTLS: %w", err)
+			}
+		}
+		return client, nil
+	}()
+	endSpan(dial, err)
+	if err != nil {
+		return nil, err
+	}
+
+	_, auth := tracer.Start(ctx, "smtp.auth")
+	err = func() error {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		return client.Auth(smtp.PlainAuth("", c.Username, c.Password, c.Host))
+	}()
+	endSpan(auth, err)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("AUTH: %w", err)
+	}
+	return client, nil
+}
+
+// write sends one message on an established session and quits.
+func write(client *smtp.Client, from string, to []string, msg []byte) error {
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
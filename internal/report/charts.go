@@ -0,0 +1,183 @@
+package report
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+)
+
+// Charts are inline SVG, so the mail loads nothing from elsewhere. The
+// output depends only on the data: no maps are iterated and every number is
+// formatted with fixed precision.
+
+const (
+	chartWidth  = 720
+	chartHeight = 220
+	plotLeft    = 40 // room for the y axis labels
+	plotRight   = 10
+	plotTop     = 10
+	plotBottom  = 30 // room for the x axis labels
+)
+
+// reasonColors are assigned to reasons in order; the last is for "Other".
+var reasonColors = []string{"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f", "#bab0ac"}
+
+// maxStacked is the number of reasons shown separately before "Other".
+var maxStacked = len(reasonColors) - 1
+
+// DayReasons is the number of entries per reason on one day.
+type DayReasons struct {
+	Day    time.Time
+	Counts []int // in the order of Stats.WeekReasons
+}
+
+// hourlyChart renders counts per hour starting at since as a bar chart.
+func hourlyChart(since time.Time, counts []int) string {
+	maxCount := 0
+	for _, c := range counts {
+		maxCount = max(maxCount, c)
+	}
+	top := axisMax(maxCount)
+
+	var b strings.Builder
+	openChart(&b, "Blocked attempts per hour")
+	yAxis(&b, top)
+
+	plotWidth := float64(chartWidth - plotLeft - plotRight)
+	plotHeight := float64(chartHeight - plotTop - plotBottom)
+	slot := plotWidth / float64(max(len(counts), 1))
+	gap := 0.0
+	if slot >= 4 {
+		gap = slot * 0.2
+	}
+	for i, c := range counts {
+		h := plotHeight * float64(c) / float64(top)
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s: %d</title></rect>`,
+			float64(plotLeft)+float64(i)*slot+gap/2, float64(plotTop)+plotHeight-h, slot-gap, h, reasonColors[0],
+			since.Add(time.Duration(i)*time.Hour).Format("Jan 2 15:00"), c)
+		b.WriteString("\n")
+	}
+
+	// about eight labels, on hours that are a multiple of the step
+	step := max(1, (len(counts)+7)/8)
+	for _, s := range []int{1, 2, 3, 4, 6, 12, 24, 48, 72, 168} {
+		if s >= step {
+			step = s
+			break
+		}
+	}
+	midnights := 0
+	for i := range counts {
+		t := since.Add(time.Duration(i) * time.Hour)
+		if step <= 24 && t.Hour()%step != 0 {
+			continue
+		}
+		if step > 24 {
+			if t.Hour() != 0 {
+				continue
+			}
+			midnights++
+			if (midnights-1)%(step/24) != 0 {
+				continue
+			}
+		}
+		label := t.Format("15:04")
+		if t.Hour() == 0 {
+			label = t.Format("Jan 2")
+		}
+		xLabel(&b, float64(plotLeft)+(float64(i)+0.5)*slot, label)
+	}
+	closeChart(&b)
+	return b.String()
+}
+
+// reasonChart renders a stacked bar per day, one segment per reason.
+func reasonChart(reasons []string, days []DayReasons) string {
+	maxCount := 0
+	for _, d := range days {
+		total := 0
+		for _, c := range d.Counts {
+			total += c
+		}
+		maxCount = max(maxCount, total)
+	}
+	top := axisMax(maxCount)
+
+	var b strings.Builder
+	openChart(&b, "Blocked attempts per day by reason")
+	yAxis(&b, top)
+
+	plotWidth := float64(chartWidth - plotLeft - plotRight)
+	plotHeight := float64(chartHeight - plotTop - plotBottom)
+	slot := plotWidth / float64(max(len(days), 1))
+	for i, d := range days {
+		y := float64(plotTop) + plotHeight
+		for j, c := range d.Counts {
+			if c == 0 {
+				continue
+			}
+			h := plotHeight * float64(c) / float64(top)
+			y -= h
+			fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s, %s: %d</title></rect>`,
+				float64(plotLeft)+float64(i)*slot+slot*0.15, y, slot*0.7, h, reasonColors[min(j, len(reasonColors)-1)],
+				d.Day.Format("Jan 2"), html.EscapeString(html.UnescapeString(reasons[j])), c)
+			b.WriteString("\n")
+		}
+		xLabel(&b, float64(plotLeft)+(float64(i)+0.5)*slot, d.Day.Format("Mon Jan 2"))
+	}
+	closeChart(&b)
+
+	// the legend is HTML so that long reasons wrap
+	b.WriteString(`<p style="font-size:0.85em">`)
+	for j, reason := range reasons {
+		fmt.Fprintf(&b, `<span style="white-space:nowrap;margin-right:12px"><span style="display:inline-block;width:10px;height:10px;background:%s"></span> %s</span> `,
+			reasonColors[min(j, len(reasonColors)-1)], html.EscapeString(html.UnescapeString(keyLabel(reason))))
+	}
+	b.WriteString("</p>\n")
+	return b.String()
+}
+
+func openChart(b *strings.Builder, title string) {
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" role="img" aria-label="%s" style="max-width:100%%;height:auto;font-family:Arial,sans-serif">`,
+		chartWidth, chartHeight, chartWidth, chartHeight, title)
+	fmt.Fprintf(b, "<title>%s</title>\n", title)
+}
+
+func closeChart(b *strings.Builder) {
+	fmt.Fprintf(b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#999"/>`,
+		plotLeft, chartHeight-plotBottom, chartWidth-plotRight, chartHeight-plotBottom)
+	b.WriteString("</svg>\n")
+}
+
+// yAxis draws grid lines with labels at 0, half and top.
+func yAxis(b *strings.Builder, top int) {
+	plotHeight := float64(chartHeight - plotTop - plotBottom)
+	for _, v := range []int{0, top / 2, top} {
+		y := float64(plotTop) + plotHeight - plotHeight*float64(v)/float64(top)
+		fmt.Fprintf(b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#e5e5e5"/>`, plotLeft, y, chartWidth-plotRight, y)
+		fmt.Fprintf(b, `<text x="%d" y="%.1f" font-size="11" fill="#666" text-anchor="end">%d</text>`, plotLeft-6, y+4, v)
+		b.WriteString("\n")
+	}
+}
+
+func xLabel(b *strings.Builder, x float64, label string) {
+	fmt.Fprintf(b, `<text x="%.1f" y="%d" font-size="11" fill="#666" text-anchor="middle">%s</text>`,
+		x, chartHeight-plotBottom+16, label)
+	b.WriteString("\n")
+}
+
+// axisMax rounds n up to 2, 4, 6 or 10 times a power of ten, so that the
+// middle grid line has a whole-number label.
+func axisMax(n int) int {
+	if n <= 2 {
+		return 2
+	}
+	for scale := 1; ; scale *= 10 {
+		for _, m := range []int{2, 4, 6, 10} {
+			if m*scale >= n {
+				return m * scale
+			}
+		}
+	}
+}
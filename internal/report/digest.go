@@ -0,0 +1,486 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/archive"
+)
+
+var errArchiveDisabled = errors.New("the submission digest needs SUBMISSION_ARCHIVE_ENABLED=true")
+
+// archiveEnabled reports whether accepted submissions are archived, which
+// the digest is made from.
+func archiveEnabled() bool {
+	return os.Getenv("SUBMISSION_ARCHIVE_ENABLED") == "true"
+}
+
+// RunDigest implements "hugo-contact digest", the report of accepted
+// submissions. It takes the flags of Run and the DIGEST_ variables in place
+// of the SPAM_REPORT_ ones; unlike the spam report, a digest without
+// submissions is sent too.
+func RunDigest(ctx context.Context, args []string) error {
+	window, outputs, err := parseCommand(digest, "digest", args)
+	if err != nil || outputs == nil {
+		return err
+	}
+
+	sent, err := GenerateDigest(ctx, window, outputs)
+	if err != nil {
+		return err
+	}
+	log.Printf("Submission digest sent with %d submissions", sent)
+	return nil
+}
+
+// GenerateDigest delivers the digest of the submissions received in w to
+// outputs and returns their number.
+func GenerateDigest(ctx context.Context, w Window, outputs []Output) (int, error) {
+	if !archiveEnabled() {
+		return 0, errArchiveDisabled
+	}
+	store := archive.New()
+	subs, err := store.Search(archive.Filter{Since: w.Since, Until: w.Until})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read submission archive: %w", err)
+	}
+
+	// for the trend; an unreadable previous period only loses the comparison
+	previous := -1
+	prev := w.Previous()
+	if prevSubs, err := store.Search(archive.Filter{Since: prev.Since, Until: prev.Until}); err == nil {
+		previous = len(prevSubs)
+	}
+
+	// Search returns the most recent first
+	maxRows := digest.maxRows()
+	var failures []archive.Submission
+	for _, s := range subs {
+		if s.DeliveryStatus == archive.DeliveryFailed {
+			failures = append(failures, s)
+		}
+	}
+	v := digestView{
+		Window:      w,
+		Stats:       computeDigestStats(subs, previous),
+		Submissions: subs[:min(len(subs), maxRows)],
+		Failures:    failures[:min(len(failures), maxRows)],
+		All:         subs,
+	}
+	if err := deliver(ctx, v, outputs); err != nil {
+		return 0, err
+	}
+	return len(subs), nil
+}
+
+// digestStats summarises the submissions of a digest.
+type digestStats struct {
+	Total     int
+	Previous  int // submissions in the preceding period, -1 if unknown
+	Delivered int
+	Failed    int
+	Pending   int // not yet delivered, or lost to a crash
+	Forms     []formStats
+}
+
+// formStats counts the submissions of one form.
+type formStats struct {
+	Form   string
+	Total  int
+	Failed int
+}
+
+// computeDigestStats counts subs by delivery status and by form, the forms
+// with the most submissions first.
+func computeDigestStats(subs []archive.Submission, previous int) digestStats {
+	s := digestStats{Total: len(subs), Previous: previous}
+	forms := make(map[string]*formStats)
+	for _, sub := range subs {
+		f := forms[sub.FormID]
+		if f == nil {
+			f = &formStats{Form: sub.FormID}
+			forms[sub.FormID] = f
+		}
+		f.Total++
+		switch sub.DeliveryStatus {
+		case archive.DeliveryDelivered:
+			s.Delivered++
+		case archive.DeliveryFailed:
+			s.Failed++
+			f.Failed++
+		default:
+			s.Pending++
+		}
+	}
+	for _, f := range forms {
+		s.Forms = append(s.Forms, *f)
+	}
+	sort.Slice(s.Forms, func(i, j int) bool {
+		if s.Forms[i].Total != s.Forms[j].Total {
+			return s.Forms[i].Total > s.Forms[j].Total
+		}
+		return s.Forms[i].Form < s.Forms[j].Form
+	})
+	return s
+}
+
+// digestView is what a rendered submission digest shows.
+type digestView struct {
+	Window      Window
+	Stats       digestStats
+	Submissions []archive.Submission // newest first, at most DIGEST_MAX_ROWS
+	Failures    []archive.Submission // the failed deliveries, as many
+	All         []archive.Submission
+	Attached    bool // all submissions are in the CSV attachment of the mail
+}
+
+func (v digestView) kind() kind { return digest }
+
+func (v digestView) window() Window { return v.Window }
+
+func (v digestView) title() string { return digest.title(v.Window) }
+
+func (v digestView) subject() string {
+	return fmt.Sprintf("%s - %d submissions", v.title(), v.Stats.Total)
+}
+
+func (v digestView) render(format string, attached bool) ([]byte, error) {
+	v.Attached = attached
+	switch format {
+	case FormatHTML:
+		return []byte(generateHTMLDigest(v)), nil
+	case FormatMarkdown:
+		return []byte(generateMarkdownDigest(v)), nil
+	case FormatText:
+		return []byte(generateTextDigest(v)), nil
+	case FormatJSON:
+		return generateJSONDigest(v, true)
+	case FormatSummary:
+		return generateJSONDigest(v, false)
+	case FormatCSV:
+		var buf bytes.Buffer
+		err := archive.WriteCSV(&buf, v.All)
+		return buf.Bytes(), err
+	}
+	return nil, fmt.Errorf("unknown report format %q", format)
+}
+
+// statuses sums up the delivery outcomes, e.g. "11 delivered, 1 failed".
+func (v digestView) statuses() string {
+	s := fmt.Sprintf("%d delivered, %d failed", v.Stats.Delivered, v.Stats.Failed)
+	if v.Stats.Pending > 0 {
+		s += fmt.Sprintf(", %d pending", v.Stats.Pending)
+	}
+	return s
+}
+
+func (v digestView) truncation() string {
+	return truncation(len(v.Submissions), v.Stats.Total, "submissions", v.Attached)
+}
+
+func (v digestView) failureTruncation() string {
+	return truncation(len(v.Failures), v.Stats.Failed, "failed deliveries", v.Attached)
+}
+
+func (v digestView) time(s archive.Submission) string {
+	return s.ReceivedAt.In(v.Window.Until.Location()).Format("Jan 2 15:04")
+}
+
+// digestSummary is a few lines of Markdown for chat messages.
+func digestSummary(v digestView) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%s* (%s)\n", v.title(), v.Window)
+	fmt.Fprintf(&b, "%d submissions, change: %s\n", v.Stats.Total, change(v.Stats.Total, v.Stats.Previous))
+	if v.Stats.Failed > 0 {
+		fmt.Fprintf(&b, "Delivery failures: %d\n", v.Stats.Failed)
+	}
+	if len(v.Stats.Forms) > 0 {
+		var forms []string
+		for _, f := range v.Stats.Forms[:min(len(v.Stats.Forms), 5)] {
+			forms = append(forms, fmt.Sprintf("%s %d", keyLabel(f.Form), f.Total))
+		}
+		b.WriteString("By form: " + strings.Join(forms, ", ") + "\n")
+	}
+	return b.String()
+}
+
+func generateTextDigest(v digestView) string {
+	var b strings.Builder
+	b.WriteString(v.title() + "\n")
+	b.WriteString(v.Window.String() + "\n\n")
+	fmt.Fprintf(&b, "Submissions: %d\n", v.Stats.Total)
+	fmt.Fprintf(&b, "Change: %s\n", change(v.Stats.Total, v.Stats.Previous))
+	fmt.Fprintf(&b, "Delivery: %s\n", v.statuses())
+
+	if len(v.Stats.Forms) > 0 {
+		b.WriteString("\nBy form\n")
+		tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+		for _, f := range v.Stats.Forms {
+			fmt.Fprintf(tw, "  %s\t%d\t%d failed\n", keyLabel(f.Form), f.Total, f.Failed)
+		}
+		tw.Flush()
+	}
+
+	if len(v.Failures) > 0 {
+		b.WriteString("\nDelivery failures\n")
+		if note := v.failureTruncation(); note != "" {
+			b.WriteString(note + "\n")
+		}
+		tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+		for _, s := range v.Failures {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\n", v.time(s), keyLabel(s.FormID), s.Email, s.Subject, s.DeliveryError)
+		}
+		tw.Flush()
+	}
+
+	b.WriteString("\nSubmissions\n")
+	if len(v.Submissions) == 0 {
+		b.WriteString("  None in this period.\n")
+	}
+	if note := v.truncation(); note != "" {
+		b.WriteString(note + "\n")
+	}
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	for _, s := range v.Submissions {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\t%s\n", v.time(s), keyLabel(s.FormID), s.DeliveryStatus, s.Name, s.Email, s.Subject)
+	}
+	tw.Flush()
+
+	b.WriteString("\nThis is an automated digest from the Hugo Contact Form.\n")
+	return b.String()
+}
+
+func generateMarkdownDigest(v digestView) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", v.title())
+	fmt.Fprintf(&b, "- **Reporting period:** %s\n", v.Window)
+	fmt.Fprintf(&b, "- **Submissions:** %d\n", v.Stats.Total)
+	fmt.Fprintf(&b, "- **Change:** %s\n", change(v.Stats.Total, v.Stats.Previous))
+	fmt.Fprintf(&b, "- **Delivery:** %s\n", v.statuses())
+
+	if len(v.Stats.Forms) > 0 {
+		b.WriteString("\n## By Form\n\n| Form | Submissions | Failed |\n|---|---:|---:|\n")
+		for _, f := range v.Stats.Forms {
+			fmt.Fprintf(&b, "| %s | %d | %d |\n", markdownText(keyLabel(f.Form)), f.Total, f.Failed)
+		}
+	}
+
+	if len(v.Failures) > 0 {
+		b.WriteString("\n## Delivery Failures\n\n")
+		if note := v.failureTruncation(); note != "" {
+			b.WriteString("_" + note + "_\n\n")
+		}
+		b.WriteString("| Time | Form | Email | Subject | Error |\n|---|---|---|---|---|\n")
+		for _, s := range v.Failures {
+			fmt.Fprintf(&b, "| %s | %s | %s | %s | %s |\n", v.time(s), markdownText(keyLabel(s.FormID)),
+				markdownText(s.Email), markdownText(s.Subject), markdownText(s.DeliveryError))
+		}
+	}
+
+	b.WriteString("\n## Submissions\n\n")
+	if len(v.Submissions) == 0 {
+		b.WriteString("None in this period.\n")
+		return b.String()
+	}
+	if note := v.truncation(); note != "" {
+		b.WriteString("_" + note + "_\n\n")
+	}
+	b.WriteString("| Time | Form | Status | Name | Email | Subject |\n|---|---|---|---|---|---|\n")
+	for _, s := range v.Submissions {
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %s |\n", v.time(s), markdownText(keyLabel(s.FormID)), s.DeliveryStatus,
+			markdownText(s.Name), markdownText(s.Email), markdownText(s.Subject))
+	}
+	return b.String()
+}
+
+func generateHTMLDigest(v digestView) string {
+	var b strings.Builder
+	esc := html.EscapeString
+
+	b.WriteString(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <title>` + v.title() + `</title>
+    <style>
+        body { font-family: Arial, sans-serif; margin: 20px; }
+        h1 { color: #333; }
+        h2 { color: #333; font-size: 1.2em; margin-top: 30px; }
+        table { border-collapse: collapse; width: 100%; margin-top: 20px; }
+        th, td { border: 1px solid #ddd; padding: 8px; text-align: left; }
+        th { background-color: #f2f2f2; font-weight: bold; }
+        tr:nth-child(even) { background-color: #f9f9f9; }
+        td.count { text-align: right; white-space: nowrap; }
+        td.failed { color: #c0392b; }
+        .truncated { color: #666; font-style: italic; }
+        .summary { margin: 20px 0; padding: 15px; background-color: #e8f4f8; border-radius: 5px; }
+        .footer { margin-top: 30px; color: #666; font-size: 0.9em; }
+    </style>
+</head>
+<body>
+    <h1>` + v.title() + `</h1>
+    <div class="summary">
+        <p><strong>Submissions:</strong> ` + strconv.Itoa(v.Stats.Total) + `</p>
+        <p><strong>Change:</strong> ` + change(v.Stats.Total, v.Stats.Previous) + `</p>
+        <p><strong>Delivery:</strong> ` + v.statuses() + `</p>
+        <p><strong>Reporting Period:</strong> ` + v.Window.String() + `</p>
+    </div>
+`)
+
+	if len(v.Stats.Forms) > 0 {
+		b.WriteString(`
+    <h2>By Form</h2>
+    <table>
+        <thead><tr><th>Form</th><th>Submissions</th><th>Failed</th></tr></thead>
+        <tbody>`)
+		for _, f := range v.Stats.Forms {
+			b.WriteString("<tr><td>" + esc(keyLabel(f.Form)) + "</td><td class=\"count\">" + strconv.Itoa(f.Total) +
+				"</td><td class=\"count\">" + strconv.Itoa(f.Failed) + "</td></tr>")
+		}
+		b.WriteString(`
+        </tbody>
+    </table>
+`)
+	}
+
+	if len(v.Failures) > 0 {
+		b.WriteString(`
+    <h2>Delivery Failures</h2>
+`)
+		if note := v.failureTruncation(); note != "" {
+			b.WriteString("    <p class=\"truncated\">" + note + "</p>\n")
+		}
+		b.WriteString(`    <table>
+        <thead><tr><th>Time</th><th>Form</th><th>Email</th><th>Subject</th><th>Error</th></tr></thead>
+        <tbody>`)
+		for _, s := range v.Failures {
+			b.WriteString("<tr><td>" + v.time(s) + "</td><td>" + esc(keyLabel(s.FormID)) + "</td><td>" + esc(s.Email) +
+				"</td><td>" + esc(s.Subject) + "</td><td class=\"failed\">" + esc(s.DeliveryError) + "</td></tr>")
+		}
+		b.WriteString(`
+        </tbody>
+    </table>
+`)
+	}
+
+	b.WriteString(`
+    <h2>Submissions</h2>
+`)
+	if len(v.Submissions) == 0 {
+		b.WriteString("    <p>None in this period.</p>\n")
+	} else {
+		if note := v.truncation(); note != "" {
+			b.WriteString("    <p class=\"truncated\">" + note + "</p>\n")
+		}
+		b.WriteString(`    <table>
+        <thead><tr><th>Time</th><th>Form</th><th>Status</th><th>Name</th><th>Email</th><th>Subject</th></tr></thead>
+        <tbody>`)
+		for _, s := range v.Submissions {
+			status := "<td>" + esc(s.DeliveryStatus) + "</td>"
+			if s.DeliveryStatus == archive.DeliveryFailed {
+				status = "<td class=\"failed\">" + esc(s.DeliveryStatus) + "</td>"
+			}
+			b.WriteString("<tr><td>" + v.time(s) + "</td><td>" + esc(keyLabel(s.FormID)) + "</td>" + status +
+				"<td>" + esc(s.Name) + "</td><td>" + esc(s.Email) + "</td><td>" + esc(s.Subject) + "</td></tr>")
+		}
+		b.WriteString(`
+        </tbody>
+    </table>
+`)
+	}
+
+	b.WriteString(`
+    <div class="footer">
+        <p>This is an automated digest from the Hugo Contact Form.</p>
+    </div>
+</body>
+</html>`)
+	return b.String()
+}
+
+// jsonDigestSummary is the summary format of the digest. Like
+// jsonReportSummary, Text is the chat summary.
+type jsonDigestSummary struct {
+	Title     string     `json:"title"`
+	Text      string     `json:"text"`
+	Period    string     `json:"period,omitempty"`
+	Since     time.Time  `json:"since"`
+	Until     time.Time  `json:"until"`
+	Total     int        `json:"total"`
+	Previous  *int       `json:"previous"`
+	Delivered int        `json:"delivered"`
+	Failed    int        `json:"failed"`
+	Pending   int        `json:"pending"`
+	Forms     []jsonForm `json:"forms"`
+}
+
+// jsonDigest is the JSON format of the digest, the summary with the
+// submissions.
+type jsonDigest struct {
+	jsonDigestSummary
+	Failures         []archive.Submission `json:"failures"`
+	Submissions      []archive.Submission `json:"submissions"`
+	SubmissionsTotal int                  `json:"submissions_total"`
+}
+
+type jsonForm struct {
+	Form   string `json:"form"`
+	Count  int    `json:"count"`
+	Failed int    `json:"failed"`
+}
+
+// generateJSONDigest renders the json format, or with submissions false the
+// summary format.
+func generateJSONDigest(v digestView, submissions bool) ([]byte, error) {
+	s := jsonDigestSummary{
+		Title:     v.title(),
+		Text:      digestSummary(v),
+		Period:    v.Window.Period,
+		Since:     v.Window.Since,
+		Until:     v.Window.Until,
+		Total:     v.Stats.Total,
+		Delivered: v.Stats.Delivered,
+		Failed:    v.Stats.Failed,
+		Pending:   v.Stats.Pending,
+		Forms:     []jsonForm{},
+	}
+	if v.Stats.Previous >= 0 {
+		s.Previous = &v.Stats.Previous
+	}
+	for _, f := range v.Stats.Forms {
+		s.Forms = append(s.Forms, jsonForm{Form: f.Form, Count: f.Total, Failed: f.Failed})
+	}
+
+	var r interface{} = s
+	if submissions {
+		full := jsonDigest{
+			jsonDigestSummary: s,
+			Failures:          v.Failures,
+			Submissions:       v.Submissions,
+			SubmissionsTotal:  v.Stats.Total,
+		}
+		if full.Failures == nil {
+			full.Failures = []archive.Submission{}
+		}
+		if full.Submissions == nil {
+			full.Submissions = []archive.Submission{}
+		}
+		r = full
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
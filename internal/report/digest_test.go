@@ -0,0 +1,57 @@
+package report
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/archive"
+)
+
+func testSubmissions() []archive.Submission {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2026, 3, 9, hour, minute, 0, 0, time.UTC)
+	}
+	return []archive.Submission{
+		{ID: "5", ReceivedAt: at(18, 40), FormID: "contact", Name: "Ann", Email: "ann@example.com", Subject: "Quote & terms", DeliveryStatus: archive.DeliveryDelivered},
+		{ID: "4", ReceivedAt: at(16, 5), FormID: "newsletter", Name: "Bob", Email: "bob@example.com", DeliveryStatus: archive.DeliveryFailed, DeliveryError: "554 5.7.1 rejected"},
+		{ID: "3", ReceivedAt: at(12, 30), FormID: "contact", Name: "Cat", Email: "cat@example.com", Subject: "<Hello>", DeliveryStatus: archive.DeliveryFailed, DeliveryError: "dial tcp: i/o timeout"},
+		{ID: "2", ReceivedAt: at(9, 15), FormID: "support", Name: "Dan", Email: "dan@example.com", Subject: "Login", DeliveryStatus: archive.DeliveryPending},
+		{ID: "1", ReceivedAt: at(8, 0), FormID: "contact", Name: "Eve", Email: "eve@example.com", Subject: "Hi", DeliveryStatus: archive.DeliveryDelivered},
+	}
+}
+
+func TestDigestStats(t *testing.T) {
+	got := computeDigestStats(testSubmissions(), 7)
+	want := digestStats{
+		Total:     5,
+		Previous:  7,
+		Delivered: 2,
+		Failed:    2,
+		Pending:   1,
+		Forms: []formStats{
+			{Form: "contact", Total: 3, Failed: 1},
+			{Form: "newsletter", Total: 1, Failed: 1},
+			{Form: "support", Total: 1},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("computeDigestStats = %+v, want %+v", got, want)
+	}
+
+	if got := computeDigestStats(nil, -1); got.Total != 0 || got.Forms != nil {
+		t.Errorf("computeDigestStats(nil) = %+v, want empty", got)
+	}
+}
+
+func TestHTMLDigest(t *testing.T) {
+	subs := testSubmissions()
+	v := digestView{
+		Window:      testWindow,
+		Stats:       computeDigestStats(subs, 7),
+		Submissions: subs[:3],
+		Failures:    []archive.Submission{subs[1], subs[2]},
+		All:         subs,
+	}
+	golden(t, "digest.html.golden", []byte(generateHTMLDigest(v)))
+}
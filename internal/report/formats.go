@@ -0,0 +1,180 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/spamlog"
+)
+
+// summary is a few lines of Markdown for chat messages: the totals and the
+// most frequent reasons.
+func summary(v view) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%s* (%s)\n", v.title(), v.Window)
+	fmt.Fprintf(&b, "%d attempts blocked, change: %s\n", v.Stats.Total, v.Stats.Change())
+	if len(v.Stats.Reasons) > 0 {
+		var reasons []string
+		for _, g := range v.Stats.Reasons[:min(len(v.Stats.Reasons), 3)] {
+			reasons = append(reasons, fmt.Sprintf("%s %d", html.UnescapeString(keyLabel(g.Keys[0])), g.Count))
+		}
+		b.WriteString("Top reasons: " + strings.Join(reasons, ", ") + "\n")
+	}
+	return b.String()
+}
+
+func generateMarkdownReport(v view) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", v.title())
+	fmt.Fprintf(&b, "- **Reporting period:** %s\n", v.Window)
+	fmt.Fprintf(&b, "- **Total spam blocked:** %d entries\n", v.Stats.Total)
+	fmt.Fprintf(&b, "- **Change:** %s\n", v.Stats.Change())
+
+	groups := func(title, column string, groups []spamlog.Group) {
+		if len(groups) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "\n## %s\n\n| %s | Count | Share |\n|---|---:|---:|\n", title, column)
+		for _, g := range groups {
+			fmt.Fprintf(&b, "| %s | %d | %s |\n", markdownCell(keyLabel(g.Keys[0])), g.Count, v.Stats.Share(g.Count))
+		}
+	}
+	groups("By Reason", "Reason", v.Stats.Reasons)
+	groups("Top Sender Domains", "Domain", v.Stats.Domains)
+	groups("Top IP Addresses", "IP Address", v.Stats.IPs)
+	groups("Top Subnets", "Subnet", v.Stats.Subnets)
+
+	b.WriteString("\n## By Hour of Day\n\n|")
+	for hour := range v.Stats.Hourly {
+		fmt.Fprintf(&b, " %02d |", hour)
+	}
+	b.WriteString("\n|")
+	for range v.Stats.Hourly {
+		b.WriteString("---:|")
+	}
+	b.WriteString("\n|")
+	for _, count := range v.Stats.Hourly {
+		fmt.Fprintf(&b, " %d |", count)
+	}
+
+	b.WriteString("\n\n## Latest Entries\n\n")
+	if note := v.truncation(); note != "" {
+		b.WriteString("_" + note + "_\n\n")
+	}
+	b.WriteString("| Time | Reason | IP Address | Sender Email | Subject |\n|---|---|---|---|---|\n")
+	for _, e := range v.Entries {
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %s |\n", e.Timestamp.In(v.Window.Until.Location()).Format("Jan 2 15:04:05"),
+			markdownCell(e.Reason), markdownCell(e.ClientIP), markdownCell(e.SenderEmail), markdownCell(e.Subject))
+	}
+	return b.String()
+}
+
+// markdownCell unescapes a logged value and keeps it from breaking the
+// table or being taken as markup.
+func markdownCell(s string) string {
+	return markdownText(html.UnescapeString(s))
+}
+
+// markdownText keeps s from breaking a table or being taken as markup.
+func markdownText(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ", "|", `\|`, "<", "&lt;", ">", "&gt;", "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`).Replace(s)
+}
+
+// jsonReportSummary is the summary format. Text is the chat summary, so the
+// report can be posted as is to Slack- or Mattermost-compatible webhooks.
+type jsonReportSummary struct {
+	Title      string      `json:"title"`
+	Text       string      `json:"text"`
+	Period     string      `json:"period,omitempty"`
+	Since      time.Time   `json:"since"`
+	Until      time.Time   `json:"until"`
+	Total      int         `json:"total"`
+	Previous   *int        `json:"previous"`
+	Reasons    []jsonGroup `json:"reasons"`
+	TopIPs     []jsonGroup `json:"top_ips"`
+	TopSubnets []jsonGroup `json:"top_subnets"`
+	TopDomains []jsonGroup `json:"top_domains"`
+	Hourly     [24]int     `json:"hourly"`
+}
+
+// jsonReport is the JSON format, the summary with the entries.
+type jsonReport struct {
+	jsonReportSummary
+	Entries      []spamlog.Entry `json:"entries"`
+	EntriesTotal int             `json:"entries_total"`
+}
+
+type jsonGroup struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+// generateJSONReport renders the json format, or with entries false the
+// summary format.
+func generateJSONReport(v view, entries bool) ([]byte, error) {
+	s := jsonReportSummary{
+		Title:      v.title(),
+		Text:       summary(v),
+		Period:     v.Window.Period,
+		Since:      v.Window.Since,
+		Until:      v.Window.Until,
+		Total:      v.Stats.Total,
+		Reasons:    jsonGroups(v.Stats.Reasons),
+		TopIPs:     jsonGroups(v.Stats.IPs),
+		TopSubnets: jsonGroups(v.Stats.Subnets),
+		TopDomains: jsonGroups(v.Stats.Domains),
+		Hourly:     v.Stats.Hourly,
+	}
+	if v.Stats.Previous >= 0 {
+		s.Previous = &v.Stats.Previous
+	}
+
+	var r interface{} = s
+	if entries {
+		full := jsonReport{jsonReportSummary: s, Entries: make([]spamlog.Entry, len(v.Entries)), EntriesTotal: v.Stats.Total}
+		for i, e := range v.Entries {
+			full.Entries[i] = unescapeEntry(e)
+		}
+		r = full
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func jsonGroups(groups []spamlog.Group) []jsonGroup {
+	out := make([]jsonGroup, len(groups))
+	for i, g := range groups {
+		out[i] = jsonGroup{Key: html.UnescapeString(g.Keys[0]), Count: g.Count}
+	}
+	return out
+}
+
+// unescapeEntry returns e with its text as submitted. The spam log keeps it
+// HTML-escaped, which JSON consumers should not have to undo.
+func unescapeEntry(e spamlog.Entry) spamlog.Entry {
+	for _, field := range []*string{&e.SenderEmail, &e.Subject, &e.Message, &e.Reason, &e.ClientIP,
+		&e.RequestID, &e.FormID, &e.UserAgent, &e.Origin, &e.Referer} {
+		*field = html.UnescapeString(*field)
+	}
+	if e.Fields != nil {
+		fields := make([]string, len(e.Fields))
+		for i, name := range e.Fields {
+			fields[i] = html.UnescapeString(name)
+		}
+		e.Fields = fields
+	}
+	if e.Scores != nil {
+		scores := make(map[string]float64, len(e.Scores))
+		for check, score := range e.Scores {
+			scores[html.UnescapeString(check)] = score
+		}
+		e.Scores = scores
+	}
+	return e
+}
@@ -0,0 +1,358 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/mail"
+)
+
+// Report formats.
+const (
+	FormatHTML     = "html"
+	FormatMarkdown = "markdown"
+	FormatText     = "text"
+	FormatJSON     = "json"
+	FormatSummary  = "summary" // json without the entries
+	FormatCSV      = "csv"
+)
+
+var formatContentTypes = map[string]string{
+	FormatHTML:     "text/html; charset=utf-8",
+	FormatMarkdown: "text/markdown; charset=utf-8",
+	FormatText:     "text/plain; charset=utf-8",
+	FormatJSON:     "application/json",
+	FormatSummary:  "application/json",
+	FormatCSV:      "text/csv; charset=utf-8",
+}
+
+// Report destinations besides file paths and webhook URLs.
+const (
+	TargetEmail  = "email"
+	TargetStdout = "stdout"
+)
+
+const webhookTimeout = 10 * time.Second
+
+// Output is one destination of a report in one format.
+type Output struct {
+	Format string
+	Target string // TargetEmail, TargetStdout, a file path or an http(s) URL
+}
+
+// ParseOutput parses "[format=]target". The target is email, stdout, an
+// http(s) webhook URL, or a file as "file:path" or a path with a slash, in
+// which {since}, {until} (dates) and {period} are replaced. Without a format,
+// email gets HTML with a plain-text alternative, stdout text, a webhook the
+// summary, which leaves out the entries, and a file the format of its
+// extension. Only a format name counts as the prefix, so
+// "https://example.com/hook?token=x" is a target.
+func ParseOutput(spec string) (Output, error) {
+	format, target := "", strings.TrimSpace(spec)
+	if prefix, rest, ok := strings.Cut(target, "="); ok {
+		if _, known := formatContentTypes[prefix]; known {
+			format, target = prefix, rest
+		} else if !strings.ContainsAny(prefix, ":/") {
+			return Output{}, fmt.Errorf("report output %q: unknown format %q, want html, markdown, text, json, summary or csv", spec, prefix)
+		}
+	}
+	if target == "" {
+		return Output{}, fmt.Errorf("report output %q: missing target", spec)
+	}
+
+	o := Output{Format: format}
+	switch {
+	case target == TargetEmail || target == TargetStdout:
+		o.Target = target
+	case strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://"):
+		o.Target = target
+	case strings.HasPrefix(target, "file:"):
+		o.Target = strings.TrimPrefix(target, "file:")
+	case strings.Contains(target, "/"):
+		o.Target = target
+	default:
+		return Output{}, fmt.Errorf("report output %q: target must be email, stdout, a URL or a file path", spec)
+	}
+
+	if o.Format == "" {
+		o.Format = o.defaultFormat()
+	}
+	if _, ok := formatContentTypes[o.Format]; !ok {
+		return Output{}, fmt.Errorf("report output %q: unknown format %q, want html, markdown, text, json, summary or csv", spec, o.Format)
+	}
+	if o.Target == TargetEmail && o.Format != FormatHTML && o.Format != FormatText {
+		return Output{}, fmt.Errorf("report output %q: email is sent as html or text", spec)
+	}
+	return o, nil
+}
+
+// ParseOutputs parses a comma-separated list of outputs, as in
+// SPAM_REPORT_OUTPUTS. A comma that is part of a URL or path is written as
+// "\,".
+func ParseOutputs(specs string) ([]Output, error) {
+	var outputs []Output
+	for _, spec := range SplitOutputs(specs) {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		o, err := ParseOutput(spec)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, o)
+	}
+	return outputs, nil
+}
+
+// SplitOutputs splits a list of outputs at commas that are not escaped with
+// a backslash.
+func SplitOutputs(specs string) []string {
+	var parts []string
+	var part strings.Builder
+	for i := 0; i < len(specs); i++ {
+		switch {
+		case specs[i] == '\\' && i+1 < len(specs) && specs[i+1] == ',':
+			part.WriteByte(',')
+			i++
+		case specs[i] == ',':
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(specs[i])
+		}
+	}
+	return append(parts, part.String())
+}
+
+// outputsFromEnv returns the outputs of k, e.g. SPAM_REPORT_OUTPUTS, email if
+// unset.
+func outputsFromEnv(k kind) ([]Output, error) {
+	outputs, err := ParseOutputs(os.Getenv(k.env + "_OUTPUTS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s_OUTPUTS: %w", k.env, err)
+	}
+	if len(outputs) == 0 {
+		outputs = []Output{{Format: FormatHTML, Target: TargetEmail}}
+	}
+	return outputs, nil
+}
+
+func (o Output) defaultFormat() string {
+	switch {
+	case o.Target == TargetEmail:
+		return FormatHTML
+	case o.Target == TargetStdout:
+		return FormatText
+	case o.isWebhook():
+		// entries carry addresses and messages; send them only on request
+		return FormatSummary
+	}
+	switch strings.ToLower(filepath.Ext(o.Target)) {
+	case ".html", ".htm":
+		return FormatHTML
+	case ".md", ".markdown":
+		return FormatMarkdown
+	case ".json":
+		return FormatJSON
+	case ".csv":
+		return FormatCSV
+	}
+	return FormatText
+}
+
+func (o Output) isWebhook() bool {
+	return strings.HasPrefix(o.Target, "http://") || strings.HasPrefix(o.Target, "https://")
+}
+
+// String returns the output as ParseOutput accepts it.
+func (o Output) String() string {
+	return o.Format + "=" + o.Target
+}
+
+// label names the output in logs and errors without the path of a webhook
+// URL, which often carries its secret.
+func (o Output) label() string {
+	if o.isWebhook() {
+		if u, err := url.Parse(o.Target); err == nil {
+			return u.Scheme + "://" + u.Host + "/…"
+		}
+		return "webhook"
+	}
+	return o.Target
+}
+
+// document is a report ready to be delivered.
+type document interface {
+	kind() kind
+	window() Window
+	subject() string
+	// render returns the report in a format; attached means every row is in
+	// the CSV attachment of the mail.
+	render(format string, attached bool) ([]byte, error)
+}
+
+// deliver hands d to each output. A failing output does not keep the others
+// from getting the report; the error is then a *DeliveryError.
+func deliver(ctx context.Context, d document, outputs []Output) error {
+	failed := &DeliveryError{}
+	for _, o := range outputs {
+		if err := o.deliver(ctx, d); err != nil {
+			failed.Outputs = append(failed.Outputs, o)
+			failed.errs = append(failed.errs, fmt.Errorf("failed to send %s to %s: %w", strings.ToLower(d.kind().name), o.label(), err))
+		}
+	}
+	if len(failed.Outputs) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// DeliveryError lists the outputs a report could not be delivered to.
+type DeliveryError struct {
+	Outputs []Output
+	errs    []error
+}
+
+func (e *DeliveryError) Error() string { return errors.Join(e.errs...).Error() }
+
+func (e *DeliveryError) Unwrap() []error { return e.errs }
+
+// deliver renders d in o's format and hands it to o's target.
+func (o Output) deliver(ctx context.Context, d document) error {
+	if o.Target == TargetEmail {
+		return sendEmail(ctx, d, o.Format)
+	}
+
+	data, err := d.render(o.Format, false)
+	if err != nil {
+		return err
+	}
+	switch {
+	case o.Target == TargetStdout:
+		_, err = os.Stdout.Write(data)
+		return err
+	case o.isWebhook():
+		return postWebhook(ctx, o.Target, formatContentTypes[o.Format], data)
+	default:
+		return writeReportFile(expandPath(o.Target, d.window()), data)
+	}
+}
+
+// sendEmail mails d to the recipients of its kind, e.g.
+// SPAM_REPORT_RECIPIENT, or RECIPIENT_EMAIL if unset, as HTML with a
+// plain-text alternative or as text only. All rows are attached as CSV if
+// the kind's ATTACH_CSV variable is true.
+func sendEmail(ctx context.Context, d document, format string) error {
+	k := d.kind()
+	cfg := mail.ConfigFromEnv()
+
+	var recipients []string
+	for _, r := range strings.Split(os.Getenv(k.recipients), ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			recipients = append(recipients, r)
+		}
+	}
+	if len(recipients) == 0 && cfg.Recipient != "" {
+		recipients = []string{cfg.Recipient}
+	}
+	if len(recipients) > 0 {
+		cfg.Recipient = recipients[0]
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	attached := os.Getenv(k.env+"_ATTACH_CSV") == "true"
+	text, err := d.render(FormatText, attached)
+	if err != nil {
+		return err
+	}
+	msg := mail.Message{
+		From:    cfg.Sender,
+		To:      strings.Join(recipients, ", "),
+		Subject: d.subject(),
+		Text:    string(text),
+	}
+	if format == FormatHTML {
+		html, err := d.render(FormatHTML, attached)
+		if err != nil {
+			return err
+		}
+		msg.HTML = string(html)
+	}
+	if attached {
+		data, err := d.render(FormatCSV, attached)
+		if err != nil {
+			return err
+		}
+		w := d.window()
+		msg.Attachments = append(msg.Attachments, mail.Attachment{
+			Filename:    k.file + "-" + w.Since.Format("2006-01-02") + "-" + w.Until.Format("2006-01-02") + ".csv",
+			ContentType: "text/csv",
+			Data:        data,
+		})
+	}
+
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+	return mail.Send(ctx, cfg, data, recipients...)
+}
+
+func postWebhook(ctx context.Context, target, contentType string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err // without the URL
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func expandPath(path string, w Window) string {
+	period := w.Period
+	if period == "" {
+		period = "custom"
+	}
+	return strings.NewReplacer(
+		"{since}", w.Since.Format("2006-01-02"),
+		"{until}", w.Until.Format("2006-01-02"),
+		"{period}", period,
+	).Replace(path)
+}
+
+// writeReportFile replaces path atomically, creating its directory.
+func writeReportFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
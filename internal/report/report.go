@@ -0,0 +1,504 @@
+// Package report sends the spam report and the digest of accepted
+// submissions, on demand or on a schedule.
+package report
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/spamlog"
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/timearg"
+)
+
+// Report periods.
+const (
+	PeriodDaily   = "daily"
+	PeriodWeekly  = "weekly"
+	PeriodMonthly = "monthly"
+)
+
+const defaultMaxRows = 100
+
+// ErrUsage is returned by Run for invalid flags, after printing the usage.
+var ErrUsage = errors.New("invalid arguments")
+
+// kind is one of the reports, with the prefix of its environment variables.
+type kind struct {
+	name string // e.g. "Spam Report"
+	env  string // e.g. "SPAM_REPORT" for SPAM_REPORT_ENABLED
+	file string // names the CSV attachment
+	// recipients names the variable with the comma-separated recipients of
+	// the mail, RECIPIENT_EMAIL if unset
+	recipients string
+}
+
+var (
+	spamReport = kind{name: "Spam Report", env: "SPAM_REPORT", file: "spam", recipients: "SPAM_REPORT_RECIPIENT"}
+	digest     = kind{name: "Submission Digest", env: "DIGEST", file: "submissions", recipients: "DIGEST_RECIPIENTS"}
+)
+
+// title names the report for w, e.g. "Weekly Spam Report".
+func (k kind) title(w Window) string {
+	if w.Period == "" {
+		return k.name
+	}
+	return strings.ToUpper(w.Period[:1]) + w.Period[1:] + " " + k.name
+}
+
+// enabled reports whether the report is sent without explicit outputs.
+func (k kind) enabled() bool {
+	return os.Getenv(k.env+"_ENABLED") == "true"
+}
+
+// maxRows caps the tables of entries; the aggregates cover all of them.
+func (k kind) maxRows() int {
+	if v, err := strconv.Atoi(os.Getenv(k.env + "_MAX_ROWS")); err == nil && v >= 0 {
+		return v
+	}
+	return defaultMaxRows
+}
+
+// Window is the time range a report covers, Since inclusive and Until
+// exclusive. Period is empty for a custom range.
+type Window struct {
+	Since  time.Time
+	Until  time.Time
+	Period string
+}
+
+// PeriodWindow returns the period ending at until, counted in until's
+// location so that a day is a calendar day across DST changes.
+func PeriodWindow(period string, until time.Time) (Window, error) {
+	w := Window{Until: until, Period: period}
+	switch period {
+	case PeriodDaily:
+		w.Since = until.AddDate(0, 0, -1)
+	case PeriodWeekly:
+		w.Since = until.AddDate(0, 0, -7)
+	case PeriodMonthly:
+		w.Since = until.AddDate(0, -1, 0)
+	default:
+		return Window{}, fmt.Errorf("unknown report period %q, want daily, weekly or monthly", period)
+	}
+	return w, nil
+}
+
+// String describes the range, e.g. "Jan 2, 2006 09:00 – Jan 3, 2006 09:00".
+func (w Window) String() string {
+	const layout = "Jan 2, 2006 15:04"
+	return w.Since.Format(layout) + " – " + w.Until.Format(layout)
+}
+
+// Run implements "hugo-contact spam-report". Without flags it reports the
+// last 24 hours; -period reports the day, week or month up to -until (now
+// by default), and -since reports an arbitrary range. The report goes to
+// each -output, SPAM_REPORT_OUTPUTS by default (see ParseOutput). Without
+// -output nothing is sent unless SPAM_REPORT_ENABLED is true, and nothing is
+// sent when nothing was blocked.
+func Run(ctx context.Context, args []string) error {
+	window, outputs, err := parseCommand(spamReport, "spam-report", args)
+	if err != nil || outputs == nil {
+		return err
+	}
+
+	sent, err := Generate(ctx, window, outputs)
+	if err != nil {
+		return err
+	}
+	if sent == 0 {
+		log.Printf("No spam detected from %s", window)
+		return nil
+	}
+	log.Printf("Spam report sent successfully with %d entries", sent)
+	return nil
+}
+
+// parseCommand parses the flags the report commands share. It returns no
+// outputs, and logs why, if none were given and the report is disabled.
+func parseCommand(k kind, name string, args []string) (Window, []Output, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	period := fs.String("period", PeriodDaily, "daily, weekly or monthly")
+	since := fs.String("since", "", "start of a custom range; a date, RFC 3339 timestamp or duration before now (7d)")
+	until := fs.String("until", "", "end of the range (default now)")
+	var outputs []Output
+	fs.Func("output", "`[format=]target`, repeatable; format html, markdown, text, json, summary or csv, target email, stdout, a file path or a webhook URL", func(spec string) error {
+		o, err := ParseOutput(spec)
+		if err == nil {
+			outputs = append(outputs, o)
+		}
+		return err
+	})
+	if err := fs.Parse(args); err != nil {
+		return Window{}, nil, ErrUsage
+	}
+
+	if outputs == nil {
+		if !k.enabled() {
+			log.Printf("Not sending the %s: %s_ENABLED is not true", strings.ToLower(k.name), k.env)
+			return Window{}, nil, nil
+		}
+		var err error
+		if outputs, err = outputsFromEnv(k); err != nil {
+			return Window{}, nil, err
+		}
+	}
+
+	end, err := timearg.Parse(*until)
+	if err != nil {
+		return Window{}, nil, err
+	}
+	if end.IsZero() {
+		end = time.Now()
+	}
+
+	var window Window
+	if *since != "" {
+		start, err := timearg.Parse(*since)
+		if err != nil {
+			return Window{}, nil, err
+		}
+		if !start.Before(end) {
+			return Window{}, nil, fmt.Errorf("-since %s is not before -until %s", start.Format(time.RFC3339), end.Format(time.RFC3339))
+		}
+		window = Window{Since: start, Until: end}
+	} else if window, err = PeriodWindow(*period, end); err != nil {
+		return Window{}, nil, err
+	}
+	return window, outputs, nil
+}
+
+// Generate delivers the report for w to outputs and returns the number of
+// entries in it. Nothing is sent when nothing was blocked. A failing output
+// does not keep the others from getting the report.
+func Generate(ctx context.Context, w Window, outputs []Output) (int, error) {
+	reader := spamlog.New()
+	entries, err := reader.Query(w.filter())
+	if err != nil {
+		return 0, fmt.Errorf("failed to read spam logs: %w", err)
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+
+	// for the trend; an unreadable previous period only loses the comparison
+	previous := -1
+	if prev, err := reader.Query(w.Previous().filter()); err == nil {
+		previous = len(prev)
+	}
+
+	// the chart by reason always shows a week
+	weekStart := weekSince(w)
+	var week []spamlog.Entry
+	if w.Since.After(weekStart) {
+		if week, err = reader.Query(Window{Since: weekStart, Until: w.Until}.filter()); err != nil {
+			return 0, fmt.Errorf("failed to read spam logs: %w", err)
+		}
+	} else {
+		for _, e := range entries {
+			if !e.Timestamp.Before(weekStart) {
+				week = append(week, e)
+			}
+		}
+	}
+	stats := computeStats(w, entries, week, previous)
+
+	// most recent first
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.After(entries[j].Timestamp)
+	})
+
+	v := view{
+		Window:  w,
+		Stats:   stats,
+		Entries: entries[:min(len(entries), spamReport.maxRows())],
+		All:     entries,
+	}
+	if err := deliver(ctx, v, outputs); err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
+
+// Previous returns the window of the same period right before w.
+func (w Window) Previous() Window {
+	if w.Period != "" {
+		prev, _ := PeriodWindow(w.Period, w.Since)
+		return prev
+	}
+	return Window{Since: w.Since.Add(-w.Until.Sub(w.Since)), Until: w.Since}
+}
+
+// filter selects the entries of w; the range includes Since.
+func (w Window) filter() spamlog.Filter {
+	return spamlog.Filter{Since: w.Since.Add(-time.Nanosecond), Until: w.Until}
+}
+
+// view is what a rendered spam report shows.
+type view struct {
+	Window   Window
+	Stats    Stats
+	Entries  []spamlog.Entry // the rows of the table, at most SPAM_REPORT_MAX_ROWS
+	All      []spamlog.Entry
+	Attached bool // all entries are in the CSV attachment of the mail
+}
+
+func (v view) kind() kind { return spamReport }
+
+func (v view) window() Window { return v.Window }
+
+func (v view) title() string { return spamReport.title(v.Window) }
+
+func (v view) subject() string {
+	return fmt.Sprintf("%s - %d entries blocked", v.title(), v.Stats.Total)
+}
+
+func (v view) render(format string, attached bool) ([]byte, error) {
+	v.Attached = attached
+	switch format {
+	case FormatHTML:
+		return []byte(generateHTMLReport(v)), nil
+	case FormatMarkdown:
+		return []byte(generateMarkdownReport(v)), nil
+	case FormatText:
+		return []byte(generateTextReport(v)), nil
+	case FormatJSON:
+		return generateJSONReport(v, true)
+	case FormatSummary:
+		return generateJSONReport(v, false)
+	case FormatCSV:
+		var buf bytes.Buffer
+		err := spamlog.WriteCSV(&buf, v.All)
+		return buf.Bytes(), err
+	}
+	return nil, fmt.Errorf("unknown report format %q", format)
+}
+
+// truncation explains a capped table, or returns "".
+func (v view) truncation() string {
+	return truncation(len(v.Entries), v.Stats.Total, "entries", v.Attached)
+}
+
+// truncation explains a table that shows only the latest of total rows, or
+// returns "".
+func truncation(shown, total int, noun string, attached bool) string {
+	if shown == total {
+		return ""
+	}
+	note := fmt.Sprintf("Showing the latest %d of %d %s", shown, total, noun)
+	if attached {
+		return note + "; all of them are in the attached CSV file."
+	}
+	return note + "."
+}
+
+func generateTextReport(v view) string {
+	var b strings.Builder
+	b.WriteString(v.title() + "\n")
+	b.WriteString(v.Window.String() + "\n\n")
+	fmt.Fprintf(&b, "Total spam blocked: %d entries\n", v.Stats.Total)
+	fmt.Fprintf(&b, "Change: %s\n", v.Stats.Change())
+
+	groups := func(title string, groups []spamlog.Group) {
+		if len(groups) == 0 {
+			return
+		}
+		b.WriteString("\n" + title + "\n")
+		tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+		for _, g := range groups {
+			fmt.Fprintf(tw, "  %s\t%d\t%s\n", html.UnescapeString(keyLabel(g.Keys[0])), g.Count, v.Stats.Share(g.Count))
+		}
+		tw.Flush()
+	}
+	groups("By reason", v.Stats.Reasons)
+	groups("Top IP addresses", v.Stats.IPs)
+	groups("Top subnets", v.Stats.Subnets)
+	groups("Top sender domains", v.Stats.Domains)
+
+	b.WriteString("\nBy hour of day\n")
+	for hour, count := range v.Stats.Hourly {
+		fmt.Fprintf(&b, "  %02d:00  %d\n", hour, count)
+	}
+
+	b.WriteString("\nLatest entries\n")
+	if note := v.truncation(); note != "" {
+		b.WriteString(note + "\n")
+	}
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	for _, e := range v.Entries {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\n", e.Timestamp.In(v.Window.Until.Location()).Format("Jan 2 15:04:05"),
+			html.UnescapeString(e.Reason), e.ClientIP, html.UnescapeString(e.SenderEmail), html.UnescapeString(e.Subject))
+	}
+	tw.Flush()
+
+	b.WriteString("\nThis is an automated report from the Hugo Contact Form spam protection system.\n")
+	return b.String()
+}
+
+func generateHTMLReport(v view) string {
+	var html strings.Builder
+	w := v.Window
+
+	html.WriteString(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <title>` + v.title() + `</title>
+    <style>
+        body { font-family: Arial, sans-serif; margin: 20px; }
+        h1 { color: #333; }
+        h2 { color: #333; font-size: 1.2em; margin-top: 30px; }
+        table { border-collapse: collapse; width: 100%; margin-top: 20px; }
+        th, td { border: 1px solid #ddd; padding: 8px; text-align: left; }
+        th { background-color: #f2f2f2; font-weight: bold; }
+        tr:nth-child(even) { background-color: #f9f9f9; }
+        td.count { text-align: right; white-space: nowrap; }
+        table.hours th, table.hours td { padding: 4px; text-align: center; font-size: 0.85em; }
+        .stats { display: inline-block; vertical-align: top; width: 48%; margin-right: 1%; }
+        .message-cell { max-width: 300px; word-wrap: break-word; font-size: 0.9em; }
+        .truncated { color: #666; font-style: italic; }
+        .summary { margin: 20px 0; padding: 15px; background-color: #e8f4f8; border-radius: 5px; }
+        .footer { margin-top: 30px; color: #666; font-size: 0.9em; }
+    </style>
+</head>
+<body>
+    <h1>` + v.title() + `</h1>
+    <div class="summary">
+        <p><strong>Report Date:</strong> ` + w.Until.Format("January 2, 2006") + `</p>
+        <p><strong>Total Spam Blocked:</strong> ` + strconv.Itoa(v.Stats.Total) + ` entries</p>
+        <p><strong>Change:</strong> ` + v.Stats.Change() + `</p>
+        <p><strong>Reporting Period:</strong> ` + w.String() + `</p>
+    </div>
+`)
+
+	groups := func(title, column string, groups []spamlog.Group) {
+		if len(groups) == 0 {
+			return
+		}
+		html.WriteString(`    <div class="stats">
+    <h2>` + title + `</h2>
+    <table>
+        <thead><tr><th>` + column + `</th><th>Count</th><th>Share</th></tr></thead>
+        <tbody>`)
+		for _, g := range groups {
+			html.WriteString("<tr><td>" + escapeHTML(keyLabel(g.Keys[0])) + "</td><td class=\"count\">" + strconv.Itoa(g.Count) +
+				"</td><td class=\"count\">" + v.Stats.Share(g.Count) + "</td></tr>")
+		}
+		html.WriteString(`
+        </tbody>
+    </table>
+    </div>
+`)
+	}
+	groups("By Reason", "Reason", v.Stats.Reasons)
+	groups("Top Sender Domains", "Domain", v.Stats.Domains)
+	groups("Top IP Addresses", "IP Address", v.Stats.IPs)
+	groups("Top Subnets", "Subnet", v.Stats.Subnets)
+
+	html.WriteString(`
+    <h2>Blocked Attempts per Hour</h2>
+`)
+	html.WriteString(hourlyChart(v.Stats.TimelineStart, v.Stats.Timeline))
+	html.WriteString(`
+    <h2>Last 7 Days by Reason</h2>
+`)
+	html.WriteString(reasonChart(v.Stats.WeekReasons, v.Stats.Week))
+
+	html.WriteString(`
+    <h2>By Hour of Day</h2>
+    <table class="hours">
+        <tr>`)
+	for hour := range v.Stats.Hourly {
+		html.WriteString(fmt.Sprintf("<th>%02d</th>", hour))
+	}
+	html.WriteString("</tr>\n        <tr>")
+	for _, count := range v.Stats.Hourly {
+		html.WriteString("<td>" + strconv.Itoa(count) + "</td>")
+	}
+	html.WriteString(`</tr>
+    </table>
+
+    <h2>Latest Entries</h2>
+`)
+	if note := v.truncation(); note != "" {
+		html.WriteString("    <p class=\"truncated\">" + note + "</p>\n")
+	}
+	html.WriteString(`    <table>
+        <thead>
+            <tr>
+                <th>Time</th>
+                <th>Sender Email</th>
+                <th>Subject</th>
+                <th>Message</th>
+                <th>Reason</th>
+                <th>IP Address</th>
+            </tr>
+        </thead>
+        <tbody>`)
+
+	for _, entry := range v.Entries {
+		html.WriteString("<tr>")
+		html.WriteString("<td>" + entry.Timestamp.In(w.Until.Location()).Format("Jan 2 15:04:05") + "</td>")
+		html.WriteString("<td>" + escapeHTML(entry.SenderEmail) + "</td>")
+		html.WriteString("<td>" + escapeHTML(entry.Subject) + "</td>")
+		html.WriteString("<td class=\"message-cell\">" + formatMessage(entry.Message) + "</td>")
+		html.WriteString("<td>" + escapeHTML(entry.Reason) + "</td>")
+		html.WriteString("<td>" + escapeHTML(entry.ClientIP) + "</td>")
+		html.WriteString("</tr>")
+	}
+
+	html.WriteString(`
+        </tbody>
+    </table>
+    
+    <div class="footer">
+        <p>This is an automated report from the Hugo Contact Form spam protection system.</p>
+        <p>All data has been sanitized to prevent injection attacks.</p>
+    </div>
+</body>
+</html>`)
+
+	return html.String()
+}
+
+func escapeHTML(s string) string {
+	if s == "" {
+		return "(empty)"
+	}
+	return html.EscapeString(s)
+}
+
+func formatMessage(message string) string {
+	if message == "" {
+		return "<span class=\"truncated\">(empty)</span>"
+	}
+
+	// Escape HTML first
+	escaped := html.EscapeString(message)
+
+	// Truncate if too long and add indication
+	if len(escaped) > 200 {
+		truncated := escaped[:200]
+		// Find the last space to avoid cutting words
+		if lastSpace := strings.LastIndex(truncated, " "); lastSpace > 150 {
+			truncated = truncated[:lastSpace]
+		}
+		return truncated + "<span class=\"truncated\">... (truncated)</span>"
+	}
+
+	// Replace newlines with <br> for better display
+	escaped = strings.ReplaceAll(escaped, "\n", "<br>")
+	escaped = strings.ReplaceAll(escaped, "\r", "")
+
+	return escaped
+}
@@ -0,0 +1,173 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/spamlog"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// testWindow is the day the fixed entries fall into.
+var testWindow = Window{
+	Since:  time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC),
+	Until:  time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC),
+	Period: PeriodDaily,
+}
+
+func testEntries() []spamlog.Entry {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2026, 3, 9, hour, minute, 0, 0, time.UTC)
+	}
+	return []spamlog.Entry{
+		{Timestamp: at(22, 41), SenderEmail: "bulk@mailer.example", Subject: "SEO offer", Message: "Rank #1 on <Google> & more", Reason: "honeypot", ClientIP: "203.0.113.7"},
+		{Timestamp: at(14, 5), SenderEmail: "bulk@mailer.example", Subject: "SEO offer", Message: "Rank #1 on Google", Reason: "honeypot", ClientIP: "203.0.113.7"},
+		{Timestamp: at(14, 2), SenderEmail: "x@spam.example", Subject: "Hi", Message: "Cheap watches", Reason: "invalid token", ClientIP: "198.51.100.23"},
+		{Timestamp: at(9, 30), SenderEmail: "bot@spam.example", Subject: "Hello", Message: "Line one\nLine two", Reason: "captcha failed: timeout-or-duplicate", ClientIP: "2001:db8::1"},
+		{Timestamp: at(3, 15), SenderEmail: "x@spam.example", Subject: "Hi", Message: "Cheap watches", Reason: "invalid token", ClientIP: "198.51.100.24"},
+	}
+}
+
+func testView() view {
+	entries := testEntries()
+	// the week before the report adds older entries to the chart by reason
+	week := append(entries, spamlog.Entry{
+		Timestamp: time.Date(2026, 3, 5, 12, 0, 0, 0, time.UTC),
+		Reason:    "ip denied: 203.0.113.0/24",
+		ClientIP:  "203.0.113.9",
+	})
+	return view{
+		Window:  testWindow,
+		Stats:   computeStats(testWindow, entries, week, 3),
+		Entries: entries[:4],
+		All:     entries,
+	}
+}
+
+// golden compares got with testdata/name, or rewrites the file with -update.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the golden file; run go test -update and review the diff", name)
+	}
+}
+
+func TestHourlyChart(t *testing.T) {
+	stats := testView().Stats
+	golden(t, "hourly.svg.golden", []byte(hourlyChart(stats.TimelineStart, stats.Timeline)))
+}
+
+func TestReasonChart(t *testing.T) {
+	stats := testView().Stats
+	golden(t, "reasons.svg.golden", []byte(reasonChart(stats.WeekReasons, stats.Week)))
+}
+
+func TestHTMLReport(t *testing.T) {
+	golden(t, "report.html.golden", []byte(generateHTMLReport(testView())))
+}
+
+func TestTimelineStartsOnWallClockHour(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, _ := PeriodWindow(PeriodDaily, time.Date(2026, 3, 10, 9, 20, 0, 0, kolkata))
+	stats := computeStats(w, nil, nil, 0)
+
+	want := time.Date(2026, 3, 9, 9, 0, 0, 0, kolkata)
+	if !stats.TimelineStart.Equal(want) {
+		t.Errorf("TimelineStart = %s, want %s", stats.TimelineStart, want)
+	}
+	if len(stats.Timeline) != 25 {
+		t.Errorf("len(Timeline) = %d, want 25", len(stats.Timeline))
+	}
+}
+
+func TestWebhookGetsSummary(t *testing.T) {
+	for spec, want := range map[string]string{
+		"https://hooks.example.com/spam":      FormatSummary,
+		"json=https://hooks.example.com/spam": FormatJSON,
+		"./spam.json":                         FormatJSON,
+	} {
+		o, err := ParseOutput(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if o.Format != want {
+			t.Errorf("ParseOutput(%q).Format = %q, want %q", spec, o.Format, want)
+		}
+	}
+
+	for format, wantEntries := range map[string]bool{FormatSummary: false, FormatJSON: true} {
+		data, err := generateJSONReport(testView(), format == FormatJSON)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got map[string]json.RawMessage
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := got["entries"]; ok != wantEntries {
+			t.Errorf("%s has entries = %v, want %v", format, ok, wantEntries)
+		}
+		if _, ok := got["text"]; !ok {
+			t.Errorf("%s has no text", format)
+		}
+	}
+}
+
+func TestJSONReportUnescapes(t *testing.T) {
+	// as the spam log keeps them, HTML-escaped
+	entries := []spamlog.Entry{{
+		Timestamp:   time.Date(2026, 3, 9, 10, 0, 0, 0, time.UTC),
+		SenderEmail: "o&#39;brien@spam.example",
+		Subject:     "Tom &amp; Jerry",
+		Message:     "&lt;a href=&#34;https://spam.example&#34;&gt;",
+		Reason:      "CAPTCHA failed (turnstile): a&amp;b",
+		ClientIP:    "203.0.113.7",
+		Fields:      []string{"&lt;x&gt;"},
+	}}
+	v := view{Window: testWindow, Stats: computeStats(testWindow, entries, entries, 3), Entries: entries, All: entries}
+
+	data, err := generateJSONReport(v, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got jsonReport
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if key := got.Reasons[0].Key; key != "CAPTCHA failed (turnstile): a&b" {
+		t.Errorf("reason key = %q", key)
+	}
+	if key := got.TopDomains[0].Key; key != "spam.example" {
+		t.Errorf("domain key = %q", key)
+	}
+	e := got.Entries[0]
+	if e.SenderEmail != "o'brien@spam.example" || e.Subject != "Tom & Jerry" ||
+		e.Message != `<a href="https://spam.example">` || e.Fields[0] != "<x>" {
+		t.Errorf("entry = %+v, want the text as submitted", e)
+	}
+	// the view keeps the logged entries as they are
+	if entries[0].Subject != "Tom &amp; Jerry" {
+		t.Error("entries of the view were modified")
+	}
+}
@@ -0,0 +1,243 @@
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/archive"
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/cron"
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/spamlog"
+)
+
+const retryDelay = 5 * time.Minute
+
+// Scheduler sends a report from inside the server on a cron schedule. The
+// time of the last report is kept in a state file, so a restart neither
+// sends a report twice nor skips one that fell due while it was down.
+type Scheduler struct {
+	kind      kind
+	generate  func(context.Context, Window, []Output) (int, error)
+	schedule  *cron.Schedule
+	period    string
+	outputs   []Output
+	stateFile string
+	log       *slog.Logger
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+type schedulerState struct {
+	LastSent time.Time `json:"last_sent"`
+}
+
+// NewSchedulerFromEnv configures the spam report's scheduler from
+// SPAM_REPORT_SCHEDULE, a cron expression, SPAM_REPORT_TIMEZONE,
+// SPAM_REPORT_PERIOD, SPAM_REPORT_OUTPUTS and SPAM_REPORT_STATE_FILE. It
+// returns nil if SPAM_REPORT_ENABLED is not true or no schedule is set.
+func NewSchedulerFromEnv() (*Scheduler, error) {
+	return newSchedulerFromEnv(spamReport, spamlog.New().Dir(), Generate)
+}
+
+// NewDigestSchedulerFromEnv configures the submission digest's scheduler
+// from the DIGEST_ variables like NewSchedulerFromEnv.
+func NewDigestSchedulerFromEnv() (*Scheduler, error) {
+	s, err := newSchedulerFromEnv(digest, filepath.Dir(archive.New().Path()), GenerateDigest)
+	if err == nil && s != nil && !archiveEnabled() {
+		return nil, errArchiveDisabled
+	}
+	return s, err
+}
+
+// newSchedulerFromEnv configures the scheduler of k. The state file is kept
+// in dir unless configured.
+func newSchedulerFromEnv(k kind, dir string, generate func(context.Context, Window, []Output) (int, error)) (*Scheduler, error) {
+	expr := os.Getenv(k.env + "_SCHEDULE")
+	if !k.enabled() || expr == "" {
+		return nil, nil
+	}
+
+	loc := time.Local
+	if tz := os.Getenv(k.env + "_TIMEZONE"); tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			return nil, fmt.Errorf("%s_TIMEZONE: %w", k.env, err)
+		}
+	}
+	schedule, err := cron.Parse(expr, loc)
+	if err != nil {
+		return nil, fmt.Errorf("%s_SCHEDULE: %w", k.env, err)
+	}
+	if schedule.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("%s_SCHEDULE %q never fires", k.env, expr)
+	}
+
+	s := &Scheduler{
+		kind:      k,
+		generate:  generate,
+		schedule:  schedule,
+		period:    PeriodDaily,
+		stateFile: filepath.Join(dir, strings.ToLower(strings.ReplaceAll(k.env, "_", "-"))+"-state.json"),
+	}
+	if period := os.Getenv(k.env + "_PERIOD"); period != "" {
+		if _, err := PeriodWindow(period, time.Now()); err != nil {
+			return nil, fmt.Errorf("%s_PERIOD: %w", k.env, err)
+		}
+		s.period = period
+	}
+	if s.outputs, err = outputsFromEnv(k); err != nil {
+		return nil, err
+	}
+	if path := os.Getenv(k.env + "_STATE_FILE"); path != "" {
+		s.stateFile = path
+	}
+	return s, nil
+}
+
+// Schedule returns the cron expression.
+func (s *Scheduler) Schedule() string { return s.schedule.String() }
+
+// Location returns the time zone the schedule is evaluated in.
+func (s *Scheduler) Location() *time.Location { return s.schedule.Location() }
+
+// Period returns the period each report covers.
+func (s *Scheduler) Period() string { return s.period }
+
+// Start runs the scheduler in the background until Stop is called.
+func (s *Scheduler) Start(log *slog.Logger) {
+	s.log = log
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		s.run(ctx)
+	}()
+}
+
+// Stop ends the scheduler. A report that is being sent is finished first,
+// unless ctx expires before.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context) {
+	name := strings.ToLower(s.kind.name)
+	last, err := s.lastSent()
+	if err != nil {
+		s.log.Error("Failed to read "+name+" state", slog.String("path", s.stateFile), slog.String("error", err.Error()))
+	}
+	if last.IsZero() {
+		// first start: wait for the next activation instead of reporting
+		// whatever fell due in the past
+		last = time.Now()
+		s.saveLastSent(last)
+	}
+
+	outputs := s.outputs
+	for {
+		due := s.schedule.Next(last)
+		if due.After(time.Now()) {
+			s.log.Info("Next "+name+" scheduled", slog.Time("at", due))
+			if !sleepUntil(ctx, due) {
+				return
+			}
+		}
+
+		// after downtime, one report for the latest activation that was missed
+		for next := s.schedule.Next(due); !next.IsZero() && !next.After(time.Now()); next = s.schedule.Next(next) {
+			due = next
+		}
+
+		window, _ := PeriodWindow(s.period, due)
+		sent, err := s.generate(context.Background(), window, outputs)
+		if err != nil {
+			s.log.Error("Failed to send scheduled "+name, slog.String("error", err.Error()), slog.Duration("retry_in", retryDelay))
+			// retry only where it failed, until the next activation
+			var failed *DeliveryError
+			if errors.As(err, &failed) {
+				outputs = failed.Outputs
+			}
+			if !sleepUntil(ctx, time.Now().Add(retryDelay)) {
+				return
+			}
+			if next := s.schedule.Next(due); !next.After(time.Now()) {
+				outputs = s.outputs
+			}
+			continue
+		}
+		s.log.Info("Scheduled "+name+" done", slog.String("period", s.period),
+			slog.Time("since", window.Since), slog.Time("until", window.Until), slog.Int("entries", sent))
+
+		last = time.Now()
+		s.saveLastSent(last)
+		outputs = s.outputs
+	}
+}
+
+// sleepUntil waits in short steps so that a change of the wall clock is
+// noticed. It reports false if ctx was cancelled first.
+func sleepUntil(ctx context.Context, t time.Time) bool {
+	for now := time.Now(); now.Before(t); now = time.Now() {
+		timer := time.NewTimer(min(t.Sub(now), time.Minute))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Scheduler) lastSent() (time.Time, error) {
+	data, err := os.ReadFile(s.stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	var state schedulerState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return time.Time{}, err
+	}
+	return state.LastSent, nil
+}
+
+// saveLastSent replaces the state file atomically. A failure is only logged:
+// the report has gone out, at worst a restart repeats it.
+func (s *Scheduler) saveLastSent(t time.Time) {
+	err := func() error {
+		data, err := json.Marshal(schedulerState{LastSent: t.UTC()})
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(s.stateFile), 0755); err != nil {
+			return err
+		}
+		tmp := s.stateFile + ".tmp"
+		if err := os.WriteFile(tmp, data, 0644); err != nil {
+			return err
+		}
+		return os.Rename(tmp, s.stateFile)
+	}()
+	if err != nil {
+		s.log.Error("Failed to save "+strings.ToLower(s.kind.name)+" state", slog.String("path", s.stateFile), slog.String("error", err.Error()))
+	}
+}
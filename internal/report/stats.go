@@ -0,0 +1,138 @@
+package report
+
+import (
+	"fmt"
+	"time"
+
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/spamlog"
+)
+
+// topN is the number of rows in each "top" table.
+const topN = 10
+
+// Stats summarises the entries of a report.
+type Stats struct {
+	Total    int
+	Previous int             // entries in the preceding period, -1 if unknown
+	Reasons  []spamlog.Group // every reason, most frequent first
+	IPs      []spamlog.Group // the topN of each
+	Subnets  []spamlog.Group
+	Domains  []spamlog.Group
+	Hourly   [24]int // by hour of day in the report's time zone
+
+	TimelineStart time.Time    // the whole hour Timeline starts at
+	Timeline      []int        // per hour of the report
+	WeekReasons   []string     // the reasons stacked in Week, "Other" last
+	Week          []DayReasons // the seven days up to the end of the report
+}
+
+// weekSince is the start of the seven calendar days that end with the
+// report, which the chart by reason covers whatever the period.
+func weekSince(w Window) time.Time {
+	last := w.Until.Add(-time.Nanosecond)
+	return time.Date(last.Year(), last.Month(), last.Day()-6, 0, 0, 0, 0, w.Until.Location())
+}
+
+// computeStats summarises entries, the report, and week, the entries since
+// weekSince(w).
+func computeStats(w Window, entries, week []spamlog.Entry, previous int) Stats {
+	s := Stats{Total: len(entries), Previous: previous}
+	s.Reasons, _ = spamlog.GroupBy(entries, spamlog.ByReason)
+	s.IPs = top(spamlog.GroupBy(entries, spamlog.ByIP))
+	s.Subnets = top(spamlog.GroupBy(entries, spamlog.BySubnet))
+	s.Domains = top(spamlog.GroupBy(entries, spamlog.ByDomain))
+
+	loc := w.Until.Location()
+	for _, e := range entries {
+		s.Hourly[e.Timestamp.In(loc).Hour()]++
+	}
+
+	// the start of the hour on the wall clock; zones such as Asia/Kolkata are
+	// not whole hours off UTC
+	since := w.Since.In(loc)
+	s.TimelineStart = since.Add(-time.Duration(since.Minute())*time.Minute -
+		time.Duration(since.Second())*time.Second - time.Duration(since.Nanosecond()))
+	s.Timeline = make([]int, int((w.Until.Sub(s.TimelineStart)+time.Hour-1)/time.Hour))
+	for _, e := range entries {
+		if i := int(e.Timestamp.Sub(s.TimelineStart) / time.Hour); i >= 0 && i < len(s.Timeline) {
+			s.Timeline[i]++
+		}
+	}
+
+	reasons, _ := spamlog.GroupBy(week, spamlog.ByReason)
+	stack := make(map[string]int)
+	for i, g := range reasons {
+		if i == maxStacked && len(reasons) > maxStacked+1 {
+			s.WeekReasons = append(s.WeekReasons, "Other")
+			break
+		}
+		stack[g.Keys[0]] = i
+		s.WeekReasons = append(s.WeekReasons, g.Keys[0])
+	}
+	start := weekSince(w)
+	for i := 0; i < 7; i++ {
+		s.Week = append(s.Week, DayReasons{
+			Day:    time.Date(start.Year(), start.Month(), start.Day()+i, 0, 0, 0, 0, loc),
+			Counts: make([]int, len(s.WeekReasons)),
+		})
+	}
+	for _, e := range week {
+		t := e.Timestamp.In(loc)
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		for i := range s.Week {
+			if s.Week[i].Day.Equal(day) {
+				j, ok := stack[e.Reason]
+				if !ok {
+					j = len(s.WeekReasons) - 1 // Other
+				}
+				s.Week[i].Counts[j]++
+				break
+			}
+		}
+	}
+	return s
+}
+
+func top(groups []spamlog.Group, _ error) []spamlog.Group {
+	if len(groups) > topN {
+		return groups[:topN]
+	}
+	return groups
+}
+
+// Change describes the total against the previous period, e.g. "+25%
+// (80 in the previous period)".
+func (s Stats) Change() string {
+	return change(s.Total, s.Previous)
+}
+
+// change compares total to previous, which is -1 if unknown.
+func change(total, previous int) string {
+	switch {
+	case previous < 0:
+		return "unknown"
+	case previous == 0 && total == 0:
+		return "no change"
+	case previous == 0:
+		return "none in the previous period"
+	}
+	pct := float64(total-previous) * 100 / float64(previous)
+	return fmt.Sprintf("%+.0f%% (%d in the previous period)", pct, previous)
+}
+
+// Share returns count as a percentage of the total.
+func (s Stats) Share(count int) string {
+	if s.Total == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%.0f%%", float64(count)*100/float64(s.Total))
+}
+
+// keyLabel shows an empty group key, such as the domain of a submission
+// without an address.
+func keyLabel(key string) string {
+	if key == "" {
+		return "(none)"
+	}
+	return key
+}
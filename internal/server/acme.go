@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	defaultACMECacheDir = "/var/lib/hugo-contact/acme"
+	defaultACMEHTTPAddr = ":80"
+	letsEncryptStaging  = "https://acme-staging-v02.api.letsencrypt.org/directory"
+)
+
+// servingACME is set while certificates are obtained through ACME, so that
+// the readiness check can look at the managed certificate.
+var servingACME *ACMEConfig
+
+// ACMEConfig describes automatic certificate management. Certificates are
+// requested on the first TLS handshake for a domain and renewed 30 days
+// before they expire.
+type ACMEConfig struct {
+	Domains      []string
+	Email        string
+	CacheDir     string
+	DirectoryURL string
+	// HTTPAddr serves HTTP-01 challenges; empty leaves only TLS-ALPN-01.
+	HTTPAddr string
+	// Redirect sends all other plain HTTP requests to HTTPS.
+	Redirect bool
+
+	manager *autocert.Manager
+}
+
+// NewACMEConfig reads ACME_ENABLED, ACME_DOMAINS, ACME_EMAIL, ACME_CACHE_DIR,
+// ACME_DIRECTORY_URL, ACME_STAGING, ACME_HTTP_ADDR and ACME_HTTP_REDIRECT.
+// It returns nil when ACME is disabled.
+func NewACMEConfig() (*ACMEConfig, error) {
+	if os.Getenv("ACME_ENABLED") != "true" {
+		return nil, nil
+	}
+
+	cfg := &ACMEConfig{
+		Email:        os.Getenv("ACME_EMAIL"),
+		CacheDir:     os.Getenv("ACME_CACHE_DIR"),
+		DirectoryURL: os.Getenv("ACME_DIRECTORY_URL"),
+		HTTPAddr:     os.Getenv("ACME_HTTP_ADDR"),
+		Redirect:     os.Getenv("ACME_HTTP_REDIRECT") != "false",
+	}
+
+	for _, d := range strings.Split(os.Getenv("ACME_DOMAINS"), ",") {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			cfg.Domains = append(cfg.Domains, d)
+		}
+	}
+	if len(cfg.Domains) == 0 {
+		return nil, errors.New("ACME_DOMAINS is required when ACME_ENABLED=true")
+	}
+
+	if cfg.CacheDir == "" {
+		cfg.CacheDir = defaultACMECacheDir
+	}
+
+	if os.Getenv("ACME_STAGING") == "true" {
+		if cfg.DirectoryURL != "" {
+			return nil, errors.New("ACME_STAGING and ACME_DIRECTORY_URL are mutually exclusive")
+		}
+		cfg.DirectoryURL = letsEncryptStaging
+	}
+	if cfg.DirectoryURL == "" {
+		cfg.DirectoryURL = acme.LetsEncryptURL
+	}
+
+	switch cfg.HTTPAddr {
+	case "":
+		cfg.HTTPAddr = defaultACMEHTTPAddr
+	case "none":
+		cfg.HTTPAddr = ""
+		cfg.Redirect = false
+	}
+
+	return cfg, nil
+}
+
+// Manager returns the autocert manager for the configuration, creating it on
+// first use. It accepts the terms of service of the CA on the operator's
+// behalf.
+func (c *ACMEConfig) Manager() *autocert.Manager {
+	if c.manager == nil {
+		c.manager = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(c.CacheDir),
+			HostPolicy: autocert.HostWhitelist(c.Domains...),
+			Email:      c.Email,
+			Client:     &acme.Client{DirectoryURL: c.DirectoryURL},
+		}
+	}
+	return c.manager
+}
+
+// startACMEHTTP serves HTTP-01 challenges on the plain HTTP address and,
+// depending on the configuration, redirects everything else to HTTPS.
+func startACMEHTTP(c *ACMEConfig) {
+	if c.HTTPAddr == "" {
+		return
+	}
+
+	// nil makes autocert redirect to https:// with the same host and path
+	var fallback http.Handler
+	if !c.Redirect {
+		fallback = http.NotFoundHandler()
+	}
+
+	server := &http.Server{
+		Addr:              c.HTTPAddr,
+		Handler:           c.Manager().HTTPHandler(fallback),
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog: slog.NewLogLogger(
+			slog.NewJSONHandler(os.Stdout, nil),
+			slog.LevelError,
+		),
+	}
+	trackServer(server)
+	go func() {
+		logger.Info("Starting ACME HTTP listener", slog.String("addr", c.HTTPAddr), slog.Bool("redirect", c.Redirect))
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("ACME HTTP server failed", slog.String("error", err.Error()))
+		}
+	}()
+}
+
+// certificatePEM returns the cached key and certificate chain of the first
+// domain. Before the first handshake there is none yet.
+func (c *ACMEConfig) certificatePEM(ctx context.Context) ([]byte, error) {
+	domain := c.Domains[0]
+	data, err := c.Manager().Cache.Get(ctx, domain)
+	if errors.Is(err, autocert.ErrCacheMiss) {
+		return nil, fmt.Errorf("no certificate issued for %s yet", domain)
+	}
+	return data, err
+}
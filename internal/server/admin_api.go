@@ -0,0 +1,920 @@
+package server
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/archive"
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/spamlog"
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/timearg"
+)
+
+const (
+	adminMaxAuthFailures   = 10
+	adminAuthFailureWindow = time.Minute
+	adminMaxTrackedClients = 10000
+)
+
+// AdminAuth checks admin credentials: bearer tokens from ADMIN_TOKENS and
+// basic-auth users from ADMIN_USERS ("user:bcrypt-hash,..."). Tokens may be
+// given in plain text or as bcrypt hashes.
+//
+// bcrypt is deliberately slow, so credentials that passed once are
+// remembered by their SHA-256 digest, and a client with too many failed
+// attempts is refused for a while without checking.
+type AdminAuth struct {
+	tokens []string
+	users  map[string]string
+
+	mu       sync.Mutex
+	verified map[[sha256.Size]byte]string // digest of the header -> principal
+	failures map[string]*authFailures     // by client IP
+}
+
+type authFailures struct {
+	count int
+	reset time.Time
+}
+
+// NewAdminAuth reads the admin credentials from the environment.
+func NewAdminAuth() (*AdminAuth, error) {
+	auth := &AdminAuth{
+		users:    make(map[string]string),
+		verified: make(map[[sha256.Size]byte]string),
+		failures: make(map[string]*authFailures),
+	}
+
+	for _, token := range strings.Split(os.Getenv("ADMIN_TOKENS"), ",") {
+		if token = strings.TrimSpace(token); token != "" {
+			auth.tokens = append(auth.tokens, token)
+		}
+	}
+	for _, pair := range strings.Split(os.Getenv("ADMIN_USERS"), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		user, hash, ok := strings.Cut(pair, ":")
+		if !ok || user == "" || !isBcryptHash(hash) {
+			return nil, fmt.Errorf("invalid ADMIN_USERS entry for %q: expected user:bcrypt-hash", user)
+		}
+		auth.users[user] = hash
+	}
+
+	if len(auth.tokens) == 0 && len(auth.users) == 0 {
+		return nil, fmt.Errorf("ADMIN_TOKENS or ADMIN_USERS is required when the admin API is enabled")
+	}
+	return auth, nil
+}
+
+// Authenticate returns the name of the authenticated principal.
+func (a *AdminAuth) Authenticate(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return "", false
+	}
+
+	digest := sha256.Sum256([]byte(header))
+	a.mu.Lock()
+	principal, ok := a.verified[digest]
+	a.mu.Unlock()
+	if ok {
+		return principal, true
+	}
+
+	principal, ok = a.check(r, header)
+	if ok {
+		a.mu.Lock()
+		a.verified[digest] = principal
+		a.mu.Unlock()
+	}
+	return principal, ok
+}
+
+// Throttled reports whether the client has failed to authenticate too often
+// and, if so, when it may try again.
+func (a *AdminAuth) Throttled(clientIP string) (time.Duration, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	f, ok := a.failures[clientIP]
+	if !ok || f.count < adminMaxAuthFailures {
+		return 0, false
+	}
+	wait := time.Until(f.reset)
+	if wait <= 0 {
+		delete(a.failures, clientIP)
+		return 0, false
+	}
+	return wait, true
+}
+
+// RecordFailure counts a failed attempt against the client.
+func (a *AdminAuth) RecordFailure(clientIP string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	f, ok := a.failures[clientIP]
+	if !ok || now.After(f.reset) {
+		if len(a.failures) >= adminMaxTrackedClients {
+			for ip, old := range a.failures {
+				if now.After(old.reset) {
+					delete(a.failures, ip)
+				}
+			}
+		}
+		f = &authFailures{reset: now.Add(adminAuthFailureWindow)}
+		a.failures[clientIP] = f
+	}
+	f.count++
+}
+
+// check verifies the credentials in the Authorization header.
+func (a *AdminAuth) check(r *http.Request, header string) (string, bool) {
+	if token, ok := strings.CutPrefix(header, "Bearer "); ok {
+		for i, candidate := range a.tokens {
+			if matchSecret(candidate, token) {
+				return "token-" + strconv.Itoa(i+1), true
+			}
+		}
+		return "", false
+	}
+
+	if user, password, ok := r.BasicAuth(); ok {
+		hash, known := a.users[user]
+		if !known {
+			// compare anyway so unknown users take as long as wrong passwords
+			_ = bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+			return "", false
+		}
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+			return user, true
+		}
+	}
+
+	return "", false
+}
+
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("hugo-contact"), bcrypt.DefaultCost)
+	return hash
+})
+
+func matchSecret(stored, given string) bool {
+	if isBcryptHash(stored) {
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(given)) == nil
+	}
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(given)) == 1
+}
+
+func isBcryptHash(s string) bool {
+	return strings.HasPrefix(s, "$2a$") || strings.HasPrefix(s, "$2b$") || strings.HasPrefix(s, "$2y$")
+}
+
+// adminParam documents a query or path parameter in the OpenAPI document.
+type adminParam struct {
+	name        string
+	in          string // "query" or "path"
+	typ         string // "string" or "integer"
+	description string
+}
+
+// adminRoute is one admin API endpoint. The route table is the single source
+// for both the mux and the OpenAPI document.
+type adminRoute struct {
+	method   string
+	path     string
+	summary  string
+	params   []adminParam
+	response interface{} // example value whose type describes the response
+	handler  http.HandlerFunc
+}
+
+var (
+	paramSubmissionID = adminParam{"id", "path", "string", "Submission ID"}
+	paramQuarantineID = adminParam{"id", "path", "string", "Quarantined item ID"}
+	paramLimit        = adminParam{"limit", "query", "integer", "Maximum number of results"}
+	paramSince        = adminParam{"since", "query", "string", "Date, RFC 3339 timestamp or duration before now (e.g. 7d)"}
+	paramUntil        = adminParam{"until", "query", "string", "Date, RFC 3339 timestamp or duration before now"}
+)
+
+// QueueState describes outbound mail. Deliveries are synchronous, so the
+// queue consists of requests currently talking to SMTP plus archived
+// submissions whose delivery is pending or failed.
+type QueueState struct {
+	InFlight int64                `json:"in_flight"`
+	Pending  []archive.Submission `json:"pending"`
+	Failed   []archive.Submission `json:"failed"`
+}
+
+// adminError is the body of every non-2xx admin response.
+type adminError struct {
+	Error string `json:"error"`
+}
+
+func adminRoutes() []adminRoute {
+	return []adminRoute{
+		{
+			method:  http.MethodGet,
+			path:    "/api/spam",
+			summary: "List recent spam log entries, newest first",
+			params: []adminParam{
+				{"hours", "query", "integer", "Look back this many hours (default 24)"},
+				{"reason", "query", "string", "Reason contains (case-insensitive)"},
+				{"ip", "query", "string", "Client IP or CIDR"},
+				paramLimit,
+			},
+			response: []spamlog.Entry{},
+			handler:  adminListSpam,
+		},
+		{
+			method:  http.MethodGet,
+			path:    "/api/submissions",
+			summary: "Search archived submissions, newest first",
+			params: []adminParam{
+				{"email", "query", "string", "Sender address contains"},
+				{"text", "query", "string", "Name, subject or message contains"},
+				{"form", "query", "string", "Form ID"},
+				{"status", "query", "string", "Delivery status: pending, delivered or failed"},
+				paramSince, paramUntil, paramLimit,
+			},
+			response: []archive.Submission{},
+			handler:  adminListSubmissions,
+		},
+		{
+			method:   http.MethodGet,
+			path:     "/api/submissions/{id}",
+			summary:  "Get an archived submission",
+			params:   []adminParam{paramSubmissionID},
+			response: archive.Submission{},
+			handler:  adminGetSubmission,
+		},
+		{
+			method:   http.MethodPost,
+			path:     "/api/submissions/{id}/spam",
+			summary:  "Mark an archived submission as spam",
+			params:   []adminParam{paramSubmissionID},
+			response: archive.Submission{},
+			handler:  adminSubmissionVerdict(archive.VerdictSpam),
+		},
+		{
+			method:   http.MethodPost,
+			path:     "/api/submissions/{id}/ham",
+			summary:  "Mark an archived submission as ham (not spam)",
+			params:   []adminParam{paramSubmissionID},
+			response: archive.Submission{},
+			handler:  adminSubmissionVerdict(archive.VerdictHam),
+		},
+		{
+			method:   http.MethodGet,
+			path:     "/api/quarantine",
+			summary:  "List quarantined submissions, newest first",
+			params:   []adminParam{{"status", "query", "string", "pending (default), released, spam or all"}},
+			response: []QuarantineItem{},
+			handler:  adminListQuarantine,
+		},
+		{
+			method:   http.MethodGet,
+			path:     "/api/quarantine/{id}",
+			summary:  "Get a quarantined submission",
+			params:   []adminParam{paramQuarantineID},
+			response: QuarantineItem{},
+			handler:  adminGetQuarantine,
+		},
+		{
+			method:   http.MethodPost,
+			path:     "/api/quarantine/{id}/ham",
+			summary:  "Release a quarantined submission (ham) and deliver it",
+			params:   []adminParam{paramQuarantineID},
+			response: QuarantineItem{},
+			handler:  adminQuarantineVerdict(archive.VerdictHam),
+		},
+		{
+			method:   http.MethodPost,
+			path:     "/api/quarantine/{id}/spam",
+			summary:  "Confirm a quarantined submission as spam",
+			params:   []adminParam{paramQuarantineID},
+			response: QuarantineItem{},
+			handler:  adminQuarantineVerdict(archive.VerdictSpam),
+		},
+		{
+			method:   http.MethodGet,
+			path:     "/api/queue",
+			summary:  "Outbound mail state",
+			response: QueueState{},
+			handler:  adminQueue,
+		},
+		{
+			method:   http.MethodGet,
+			path:     "/api/health",
+			summary:  "Readiness checks with details and errors",
+			response: ReadinessReport{},
+			handler:  adminHealth,
+		},
+		{
+			method:   http.MethodGet,
+			path:     "/api/bans",
+			summary:  "List active bans",
+			response: []BanRecord{},
+			handler:  adminListBans,
+		},
+		{
+			method:   http.MethodDelete,
+			path:     "/api/bans/{ip}",
+			summary:  "Lift the ban for an IP",
+			params:   []adminParam{{"ip", "path", "string", "Banned IP"}},
+			response: BanRecord{},
+			handler:  adminLiftBan,
+		},
+	}
+}
+
+// NewAdminHandler returns the admin API, with every route except the OpenAPI
+// document behind authentication.
+func NewAdminHandler(auth *AdminAuth) (http.Handler, error) {
+	mux := http.NewServeMux()
+	routes := adminRoutes()
+
+	for _, route := range routes {
+		mux.Handle(route.method+" "+route.path, adminAuthMiddleware(auth, route.handler))
+	}
+
+	registerDashboard(mux, auth)
+
+	spec, err := json.MarshalIndent(buildOpenAPI(routes), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to build OpenAPI document: %w", err)
+	}
+	mux.HandleFunc("GET /api/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(spec)
+	})
+
+	return mux, nil
+}
+
+// startAdminAPI serves the admin API on its own listener at
+// ADMIN_LISTEN_ADDR and/or mounts it under ADMIN_PATH_PREFIX on the public
+// mux. It does nothing when neither is set. serverTLS is the form server's
+// TLS configuration, whose certificates the admin listener can share.
+func startAdminAPI(serverTLS *tls.Config) error {
+	addr := os.Getenv("ADMIN_LISTEN_ADDR")
+	prefix := strings.TrimRight(os.Getenv("ADMIN_PATH_PREFIX"), "/")
+	if addr == "" && prefix == "" {
+		return nil
+	}
+
+	auth, err := NewAdminAuth()
+	if err != nil {
+		return err
+	}
+	handler, err := NewAdminHandler(auth)
+	if err != nil {
+		return err
+	}
+
+	if prefix != "" {
+		if !strings.HasPrefix(prefix, "/") {
+			return fmt.Errorf("ADMIN_PATH_PREFIX must start with /")
+		}
+		http.Handle(prefix+"/", http.StripPrefix(prefix, handler))
+		logger.Info("Admin API mounted", slog.String("prefix", prefix))
+	}
+
+	if addr == "" {
+		if os.Getenv("ADMIN_TLS_CLIENT_CA") != "" || os.Getenv("ADMIN_TLS_CERT_PATH") != "" || os.Getenv("ADMIN_TLS_KEY_PATH") != "" {
+			return errors.New("ADMIN_TLS_* settings need ADMIN_LISTEN_ADDR")
+		}
+		return nil
+	}
+
+	var serverCert func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	if serverTLS != nil {
+		serverCert = serverTLS.GetCertificate
+	}
+	adminTLS, store, err := newAdminTLSConfig(serverCert)
+	if err != nil {
+		return err
+	}
+	if store != nil {
+		store.Watch()
+	}
+
+	server := &http.Server{
+		Addr:      addr,
+		Handler:   handler,
+		TLSConfig: adminTLS,
+		ErrorLog: slog.NewLogLogger(
+			slog.NewJSONHandler(os.Stdout, nil),
+			slog.LevelError,
+		),
+	}
+	trackServer(server)
+	go func() {
+		logger.Info("Starting admin API", slog.String("addr", addr), slog.Bool("tls", adminTLS != nil), slog.Bool("client_certs", adminTLS != nil && adminTLS.ClientCAs != nil))
+		serve := server.ListenAndServe
+		if adminTLS != nil {
+			serve = func() error { return server.ListenAndServeTLS("", "") }
+		}
+		if err := serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Admin API server failed", slog.String("error", err.Error()))
+		}
+	}()
+
+	return nil
+}
+
+func adminAuthMiddleware(auth *AdminAuth, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := getClientIP(r)
+		if wait, throttled := auth.Throttled(ip); throttled {
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			writeAdminError(w, http.StatusTooManyRequests, "too many failed authentication attempts")
+			return
+		}
+		principal, ok := auth.Authenticate(r)
+		if !ok {
+			auth.RecordFailure(ip)
+			logger.Warn("Admin authentication failed", slog.String("path", r.URL.Path), slog.String("ip", ip))
+			w.Header().Set("WWW-Authenticate", `Basic realm="hugo-contact admin"`)
+			writeAdminError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		if r.Method != http.MethodGet {
+			logger.Info("Admin action", slog.String("principal", principal), slog.String("method", r.Method), slog.String("path", r.URL.Path))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeAdminError(w http.ResponseWriter, status int, msg string) {
+	writeAdminJSON(w, status, adminError{Error: msg})
+}
+
+func queryInt(r *http.Request, name string, fallback int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, v)
+	}
+	return n, nil
+}
+
+func adminListSpam(w http.ResponseWriter, r *http.Request) {
+	hours, err := queryInt(r, "hours", 24)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, err := queryInt(r, "limit", 0)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter := spamlog.Filter{
+		Since:  time.Now().Add(-time.Duration(hours) * time.Hour),
+		Reason: r.URL.Query().Get("reason"),
+	}
+	if ip := r.URL.Query().Get("ip"); ip != "" {
+		filter.IP, err = parseIPOrCIDR(ip)
+		if err != nil {
+			writeAdminError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	reader := spamLogger
+	if reader == nil {
+		reader = spamlog.New()
+	}
+	filtered, err := reader.Query(filter)
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if filtered == nil {
+		filtered = []spamlog.Entry{}
+	}
+
+	sort.Slice(filtered, func(i, j int) bool {
+		return filtered[i].Timestamp.After(filtered[j].Timestamp)
+	})
+	if limit > 0 && len(filtered) > limit {
+		filtered = filtered[:limit]
+	}
+	writeAdminJSON(w, http.StatusOK, filtered)
+}
+
+func requireArchive(w http.ResponseWriter) bool {
+	if submissionArchive == nil {
+		writeAdminError(w, http.StatusNotFound, "submission archive is not enabled")
+		return false
+	}
+	return true
+}
+
+func adminListSubmissions(w http.ResponseWriter, r *http.Request) {
+	if !requireArchive(w) {
+		return
+	}
+
+	q := r.URL.Query()
+	filter := archive.Filter{
+		Email:  q.Get("email"),
+		Text:   q.Get("text"),
+		FormID: q.Get("form"),
+		Status: q.Get("status"),
+	}
+	var err error
+	if filter.Limit, err = queryInt(r, "limit", 100); err != nil {
+		writeAdminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if filter.Since, err = timearg.Parse(q.Get("since")); err != nil {
+		writeAdminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if filter.Until, err = timearg.Parse(q.Get("until")); err != nil {
+		writeAdminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	subs, err := submissionArchive.Search(filter)
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if subs == nil {
+		subs = []archive.Submission{}
+	}
+	writeAdminJSON(w, http.StatusOK, subs)
+}
+
+func adminGetSubmission(w http.ResponseWriter, r *http.Request) {
+	if !requireArchive(w) {
+		return
+	}
+
+	sub, err := submissionArchive.Get(r.PathValue("id"))
+	if errors.Is(err, archive.ErrNotFound) {
+		writeAdminError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, sub)
+}
+
+func adminSubmissionVerdict(verdict string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireArchive(w) {
+			return
+		}
+
+		sub, err := submissionArchive.SetVerdict(r.PathValue("id"), verdict)
+		if errors.Is(err, archive.ErrNotFound) {
+			writeAdminError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			writeAdminError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, sub)
+	}
+}
+
+func requireQuarantine(w http.ResponseWriter) bool {
+	if quarantineStore == nil {
+		writeAdminError(w, http.StatusNotFound, "quarantine is not enabled")
+		return false
+	}
+	return true
+}
+
+func adminListQuarantine(w http.ResponseWriter, r *http.Request) {
+	if !requireQuarantine(w) {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = QuarantinePending
+	case "all":
+		status = ""
+	}
+
+	items, err := quarantineStore.List(status)
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if items == nil {
+		items = []QuarantineItem{}
+	}
+	writeAdminJSON(w, http.StatusOK, items)
+}
+
+func adminGetQuarantine(w http.ResponseWriter, r *http.Request) {
+	if !requireQuarantine(w) {
+		return
+	}
+
+	item, err := quarantineStore.Get(r.PathValue("id"))
+	if errors.Is(err, ErrQuarantineNotFound) {
+		writeAdminError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, item)
+}
+
+func adminQuarantineVerdict(verdict string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireQuarantine(w) {
+			return
+		}
+
+		var item QuarantineItem
+		var err error
+		if verdict == archive.VerdictHam {
+			item, err = quarantineStore.Release(r.PathValue("id"))
+		} else {
+			item, err = quarantineStore.MarkSpam(r.PathValue("id"))
+		}
+		switch {
+		case errors.Is(err, ErrQuarantineNotFound):
+			writeAdminError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, ErrQuarantineBusy), err != nil && item.Status != QuarantinePending:
+			writeAdminError(w, http.StatusConflict, err.Error())
+		case err != nil:
+			writeAdminError(w, http.StatusBadGateway, err.Error())
+		default:
+			writeAdminJSON(w, http.StatusOK, item)
+		}
+	}
+}
+
+func adminQueue(w http.ResponseWriter, r *http.Request) {
+	state := QueueState{
+		InFlight: deliveriesInFlight.Load(),
+		Pending:  []archive.Submission{},
+		Failed:   []archive.Submission{},
+	}
+
+	if submissionArchive != nil {
+		since := time.Now().AddDate(0, 0, -7)
+		for _, target := range []struct {
+			status string
+			dst    *[]archive.Submission
+		}{
+			{archive.DeliveryPending, &state.Pending},
+			{archive.DeliveryFailed, &state.Failed},
+		} {
+			subs, err := submissionArchive.Search(archive.Filter{Status: target.status, Since: since, Limit: 100})
+			if err != nil {
+				writeAdminError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			if subs != nil {
+				*target.dst = subs
+			}
+		}
+	}
+
+	writeAdminJSON(w, http.StatusOK, state)
+}
+
+func adminHealth(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, http.StatusOK, healthChecker.Check(r.Context()))
+}
+
+func adminListBans(w http.ResponseWriter, r *http.Request) {
+	if banTracker == nil {
+		writeAdminError(w, http.StatusNotFound, "automatic banning is not enabled")
+		return
+	}
+
+	bans := banTracker.List()
+	if bans == nil {
+		bans = []BanRecord{}
+	}
+	writeAdminJSON(w, http.StatusOK, bans)
+}
+
+func adminLiftBan(w http.ResponseWriter, r *http.Request) {
+	if banTracker == nil {
+		writeAdminError(w, http.StatusNotFound, "automatic banning is not enabled")
+		return
+	}
+
+	ip := r.PathValue("ip")
+	ban, banned := banTracker.IsBanned(ip)
+	if !banned || !banTracker.Lift(ip) {
+		writeAdminError(w, http.StatusNotFound, ip+" is not banned")
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, ban)
+}
+
+// buildOpenAPI generates an OpenAPI 3.0 document from the route table, with
+// schemas derived from the Go response types and their json tags.
+func buildOpenAPI(routes []adminRoute) map[string]interface{} {
+	schemas := map[string]interface{}{}
+	paths := map[string]map[string]interface{}{}
+
+	errorResponse := map[string]interface{}{
+		"description": "Error",
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{
+				"schema": openAPISchema(reflect.TypeOf(adminError{}), schemas),
+			},
+		},
+	}
+
+	for _, route := range routes {
+		var params []map[string]interface{}
+		for _, p := range route.params {
+			params = append(params, map[string]interface{}{
+				"name":        p.name,
+				"in":          p.in,
+				"required":    p.in == "path",
+				"description": p.description,
+				"schema":      map[string]interface{}{"type": p.typ},
+			})
+		}
+
+		op := map[string]interface{}{
+			"summary":     route.summary,
+			"operationId": strings.ToLower(route.method) + openAPIOperationName(route.path),
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "OK",
+					"content": map[string]interface{}{
+						"application/json": map[string]interface{}{
+							"schema": openAPISchema(reflect.TypeOf(route.response), schemas),
+						},
+					},
+				},
+				"401":     map[string]interface{}{"description": "Authentication required"},
+				"default": errorResponse,
+			},
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+
+		if paths[route.path] == nil {
+			paths[route.path] = map[string]interface{}{}
+		}
+		paths[route.path][strings.ToLower(route.method)] = op
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "hugo-contact admin API",
+			"version": "1",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer"},
+				"basic":  map[string]interface{}{"type": "http", "scheme": "basic"},
+			},
+		},
+		"security": []map[string]interface{}{
+			{"bearer": []string{}},
+			{"basic": []string{}},
+		},
+	}
+}
+
+func openAPIOperationName(path string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(strings.TrimPrefix(path, "/api/"), "/") {
+		part = strings.Trim(part, "{}")
+		if part == "" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// openAPISchema converts a Go type into a schema, registering named structs
+// under components/schemas.
+func openAPISchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Pointer:
+		return openAPISchema(t.Elem(), schemas)
+	case t.Kind() == reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": openAPISchema(t.Elem(), schemas)}
+	case t.Kind() == reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": openAPISchema(t.Elem(), schemas)}
+	case t.Kind() == reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case t.Kind() != reflect.Struct:
+		return map[string]interface{}{}
+	}
+
+	name := t.Name()
+	ref := map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	if _, done := schemas[name]; done {
+		return ref
+	}
+	schemas[name] = nil // placeholder against recursion
+
+	props := map[string]interface{}{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if tag == "-" {
+			continue
+		}
+		if tag == "" {
+			tag = field.Name
+		}
+		props[tag] = openAPISchema(field.Type, schemas)
+	}
+	schemas[name] = map[string]interface{}{"type": "object", "properties": props}
+	return ref
+}
+
+// RunAdminCommand implements "hugo-contact admin hash-password", which reads
+// a password or token from stdin and prints its bcrypt hash for use in
+// ADMIN_USERS or ADMIN_TOKENS.
+func RunAdminCommand(args []string) int {
+	if len(args) != 1 || args[0] != "hash-password" {
+		fmt.Fprintln(os.Stderr, "usage: hugo-contact admin hash-password")
+		return 2
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Fprintln(os.Stderr, "failed to read password from stdin")
+		return 1
+	}
+	secret := strings.TrimRight(line, "\r\n")
+	if secret == "" {
+		fmt.Fprintln(os.Stderr, "empty password")
+		return 1
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(string(hash))
+	return 0
+}
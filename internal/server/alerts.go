@@ -0,0 +1,451 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/mail"
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/report"
+)
+
+// Alert counters, the events the rules in ALERT_RULES count.
+const (
+	alertSpam             = "spam"              // spam verdicts, not bans or deny-list hits
+	alertDeliveryFailures = "delivery_failures" // submissions the SMTP server did not take
+	alertBanned           = "banned"            // requests refused because of a ban
+	alertTokenFailures    = "token_failures"    // invalid or expired form tokens
+)
+
+const (
+	defaultAlertRules    = "spam=60/1m,delivery_failures=3/10m,banned=60/1m,token_failures=30/1m"
+	defaultAlertCooldown = 30 * time.Minute
+	alertEvalInterval    = 5 * time.Second
+	alertSendTimeout     = 10 * time.Second
+	alertBuckets         = 60
+)
+
+// alertDescriptions name the counters in notifications.
+var alertDescriptions = map[string]string{
+	alertSpam:             "spam verdicts",
+	alertDeliveryFailures: "delivery failures",
+	alertBanned:           "requests refused by a ban",
+	alertTokenFailures:    "token validation failures",
+}
+
+// AlertRule fires when Counter reaches Threshold events within Window.
+type AlertRule struct {
+	Counter   string
+	Threshold int
+	Window    time.Duration
+}
+
+// String returns the rule as ALERT_RULES accepts it, e.g. "spam=60/1m".
+func (r AlertRule) String() string {
+	return r.Counter + "=" + strconv.Itoa(r.Threshold) + "/" + shortDuration(r.Window)
+}
+
+// parseAlertRules parses a comma-separated list of counter=threshold/window.
+func parseAlertRules(s string) ([]AlertRule, error) {
+	var rules []AlertRule
+	for _, spec := range strings.Split(s, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		counter, limit, ok := strings.Cut(spec, "=")
+		threshold, window, ok2 := strings.Cut(limit, "/")
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("alert rule %q: want counter=threshold/window, e.g. spam=60/1m", spec)
+		}
+		if _, ok := alertDescriptions[counter]; !ok {
+			return nil, fmt.Errorf("alert rule %q: unknown counter %q, want spam, delivery_failures, banned or token_failures", spec, counter)
+		}
+		n, err := strconv.Atoi(threshold)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("alert rule %q: invalid threshold %q", spec, threshold)
+		}
+		d, err := time.ParseDuration(window)
+		if err != nil || d < time.Second {
+			return nil, fmt.Errorf("alert rule %q: invalid window %q", spec, window)
+		}
+		rules = append(rules, AlertRule{Counter: counter, Threshold: n, Window: d})
+	}
+	return rules, nil
+}
+
+// shortDuration formats d without zero minutes and seconds, e.g. "1h".
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
+
+// slidingCounter counts events within a sliding window, in buckets of a
+// sixtieth of the window, so memory does not grow with the event rate.
+type slidingCounter struct {
+	width   time.Duration
+	buckets [alertBuckets]int
+	head    int64 // the newest bucket, in widths since the epoch
+}
+
+func newSlidingCounter(window time.Duration) slidingCounter {
+	return slidingCounter{width: window / alertBuckets}
+}
+
+// advance moves the window to now, emptying the buckets it leaves behind.
+func (c *slidingCounter) advance(now time.Time) {
+	n := now.UnixNano() / int64(c.width)
+	if n-c.head >= alertBuckets {
+		c.buckets = [alertBuckets]int{}
+		c.head = n
+	}
+	for ; c.head < n; c.head++ {
+		c.buckets[(c.head+1)%alertBuckets] = 0
+	}
+}
+
+func (c *slidingCounter) add(now time.Time) {
+	c.advance(now)
+	c.buckets[c.head%alertBuckets]++
+}
+
+func (c *slidingCounter) count(now time.Time) int {
+	c.advance(now)
+	total := 0
+	for _, n := range c.buckets {
+		total += n
+	}
+	return total
+}
+
+// alertState is a rule with its counter and whether it is firing.
+type alertState struct {
+	AlertRule
+	counter  slidingCounter
+	firing   bool
+	since    time.Time // start of the current firing
+	peak     int
+	notified bool      // the current firing was notified
+	lastSent time.Time // last alert notification of the rule
+}
+
+// Alerter evaluates the alert rules every few seconds and notifies by mail
+// and webhook when one starts firing and when it recovers. After an alert, a
+// rule stays quiet for the cooldown; if it is still firing then, the alert
+// goes out at the end of the cooldown.
+type Alerter struct {
+	mu         sync.Mutex
+	rules      []*alertState
+	cooldown   time.Duration
+	email      bool
+	webhooks   []string
+	recipients []string
+	host       string
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+// alertNotification is the JSON body posted to webhooks. Text is the
+// message, so Slack- or Mattermost-compatible webhooks can take it as is.
+type alertNotification struct {
+	Status    string    `json:"status"` // "firing" or "resolved"
+	Rule      string    `json:"rule"`
+	Counter   string    `json:"counter"`
+	Count     int       `json:"count"`
+	Peak      int       `json:"peak"`
+	Threshold int       `json:"threshold"`
+	Window    string    `json:"window"`
+	Since     time.Time `json:"since"`
+	Host      string    `json:"host"`
+	Text      string    `json:"text"`
+}
+
+// NewAlerter returns an alerter configured from ALERT_RULES, ALERT_COOLDOWN,
+// ALERT_OUTPUTS and ALERT_RECIPIENTS, or nil when ALERT_ENABLED is not
+// "true".
+func NewAlerter() (*Alerter, error) {
+	if os.Getenv("ALERT_ENABLED") != "true" {
+		return nil, nil
+	}
+
+	a := &Alerter{cooldown: defaultAlertCooldown}
+
+	spec := os.Getenv("ALERT_RULES")
+	if spec == "" {
+		spec = defaultAlertRules
+	}
+	rules, err := parseAlertRules(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ALERT_RULES: %w", err)
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("invalid ALERT_RULES %q: no rules", spec)
+	}
+	for _, r := range rules {
+		a.rules = append(a.rules, &alertState{AlertRule: r, counter: newSlidingCounter(r.Window)})
+	}
+
+	if env := os.Getenv("ALERT_COOLDOWN"); env != "" {
+		d, err := time.ParseDuration(env)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid ALERT_COOLDOWN %q", env)
+		}
+		a.cooldown = d
+	}
+
+	outputs := os.Getenv("ALERT_OUTPUTS")
+	if outputs == "" {
+		outputs = "email"
+	}
+	// separated like the report outputs, so a webhook URL can keep a comma
+	for _, o := range report.SplitOutputs(outputs) {
+		switch o = strings.TrimSpace(o); {
+		case o == "":
+		case o == "email":
+			a.email = true
+		case strings.HasPrefix(o, "http://") || strings.HasPrefix(o, "https://"):
+			if _, err := url.Parse(o); err != nil {
+				return nil, fmt.Errorf("invalid ALERT_OUTPUTS webhook: %w", err)
+			}
+			a.webhooks = append(a.webhooks, o)
+		default:
+			return nil, fmt.Errorf("invalid ALERT_OUTPUTS entry %q, want email or a webhook URL", o)
+		}
+	}
+
+	for _, r := range strings.Split(os.Getenv("ALERT_RECIPIENTS"), ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			a.recipients = append(a.recipients, r)
+		}
+	}
+
+	a.host, _ = os.Hostname()
+	return a, nil
+}
+
+// Rules returns the configured rules.
+func (a *Alerter) Rules() []string {
+	var rules []string
+	for _, st := range a.rules {
+		rules = append(rules, st.String())
+	}
+	return rules
+}
+
+// mailsOnly reports whether the alerts of counter can only go out by mail.
+func (a *Alerter) mailsOnly(counter string) bool {
+	if len(a.webhooks) > 0 {
+		return false
+	}
+	for _, st := range a.rules {
+		if st.Counter == counter {
+			return true
+		}
+	}
+	return false
+}
+
+// Record counts one event of counter.
+func (a *Alerter) Record(counter string) {
+	now := time.Now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, st := range a.rules {
+		if st.Counter == counter {
+			st.counter.add(now)
+		}
+	}
+}
+
+// Start evaluates the rules in the background until Stop.
+func (a *Alerter) Start() {
+	a.stop = make(chan struct{})
+	a.done = make(chan struct{})
+	go func() {
+		defer close(a.done)
+		ticker := time.NewTicker(alertEvalInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				a.send(context.Background(), a.evaluate(time.Now()))
+			case <-a.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the evaluation and sends the notifications that are due, so an
+// alert raised by the last requests is not lost. It waits for them until ctx
+// is done.
+func (a *Alerter) Stop(ctx context.Context) error {
+	if a.stop == nil {
+		return nil
+	}
+	close(a.stop)
+	select {
+	case <-a.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	a.send(ctx, a.evaluate(time.Now()))
+	return ctx.Err()
+}
+
+func (a *Alerter) send(ctx context.Context, due []alertNotification) {
+	for _, n := range due {
+		a.notify(ctx, n)
+	}
+}
+
+// evaluate updates the state of each rule and returns the notifications due.
+func (a *Alerter) evaluate(now time.Time) []alertNotification {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var due []alertNotification
+	for _, st := range a.rules {
+		count := st.counter.count(now)
+		switch {
+		case count >= st.Threshold:
+			if !st.firing {
+				st.firing, st.since, st.peak, st.notified = true, now, 0, false
+				logger.Warn("Alert threshold reached", slog.String("rule", st.String()), slog.Int("count", count))
+			}
+			st.peak = max(st.peak, count)
+			if !st.notified && now.Sub(st.lastSent) >= a.cooldown {
+				st.notified, st.lastSent = true, now
+				due = append(due, a.notification("firing", st, count))
+			}
+		case st.firing:
+			st.firing = false
+			logger.Info("Alert recovered", slog.String("rule", st.String()), slog.Int("count", count), slog.Int("peak", st.peak))
+			if st.notified {
+				due = append(due, a.notification("resolved", st, count))
+			}
+		}
+	}
+	return due
+}
+
+func (a *Alerter) notification(status string, st *alertState, count int) alertNotification {
+	n := alertNotification{
+		Status:    status,
+		Rule:      st.String(),
+		Counter:   st.Counter,
+		Count:     count,
+		Peak:      st.peak,
+		Threshold: st.Threshold,
+		Window:    shortDuration(st.Window),
+		Since:     st.since,
+		Host:      a.host,
+	}
+	what := alertDescriptions[st.Counter]
+	if status == "firing" {
+		n.Text = fmt.Sprintf("Alert on %s: %d %s in the last %s (threshold %d)", a.host, count, what, n.Window, st.Threshold)
+	} else {
+		n.Text = fmt.Sprintf("Resolved on %s: %s down to %d in the last %s (threshold %d), after %s with a peak of %d",
+			a.host, what, count, n.Window, st.Threshold, time.Since(st.since).Round(time.Second), st.peak)
+	}
+	return n
+}
+
+// notify sends n to every output. Failures are only logged; the next
+// notification of the rule is not held back by them.
+func (a *Alerter) notify(ctx context.Context, n alertNotification) {
+	ctx, cancel := context.WithTimeout(ctx, alertSendTimeout)
+	defer cancel()
+
+	if a.email {
+		if err := a.sendAlertEmail(ctx, n); err != nil {
+			logger.Error("Failed to send alert email", slog.String("rule", n.Rule), slog.String("error", err.Error()))
+		}
+	}
+	for _, hook := range a.webhooks {
+		if err := postAlertWebhook(ctx, hook, n); err != nil {
+			u, _ := url.Parse(hook)
+			logger.Error("Failed to post alert webhook", slog.String("rule", n.Rule), slog.String("host", u.Host), slog.String("error", err.Error()))
+		}
+	}
+}
+
+func (a *Alerter) sendAlertEmail(ctx context.Context, n alertNotification) error {
+	cfg := mail.ConfigFromEnv()
+	recipients := a.recipients
+	if len(recipients) == 0 {
+		recipients = []string{cfg.Recipient}
+	}
+	cfg.Recipient = recipients[0]
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	var body strings.Builder
+	body.WriteString(n.Text + "\n\n")
+	fmt.Fprintf(&body, "Rule: %s\n", n.Rule)
+	fmt.Fprintf(&body, "Since: %s\n", n.Since.Format(time.RFC1123))
+	if n.Status == "resolved" {
+		fmt.Fprintf(&body, "Peak: %d\n", n.Peak)
+	}
+	body.WriteString("\nThis is an automated alert from the Hugo Contact Form.\n")
+
+	data, err := mail.Message{
+		From:    cfg.Sender,
+		To:      strings.Join(recipients, ", "),
+		Subject: n.Text,
+		Text:    body.String(),
+	}.Bytes()
+	if err != nil {
+		return err
+	}
+	return mail.Send(ctx, cfg, data, recipients...)
+}
+
+func postAlertWebhook(ctx context.Context, hook string, n alertNotification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err // without the URL, which often carries a secret
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// countAlertEvent feeds the alert rules, if alerting is enabled.
+func countAlertEvent(counter string) {
+	if alerter != nil {
+		alerter.Record(counter)
+	}
+}
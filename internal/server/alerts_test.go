@@ -0,0 +1,118 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var alertEpoch = time.Date(2026, 3, 9, 12, 0, 0, 0, time.UTC)
+
+func TestSlidingCounterExpiry(t *testing.T) {
+	// buckets of one second
+	c := newSlidingCounter(time.Minute)
+	at := func(s int) time.Time { return alertEpoch.Add(time.Duration(s) * time.Second) }
+
+	c.add(at(0))
+	c.add(at(0))
+	c.add(at(30))
+	if n := c.count(at(30)); n != 3 {
+		t.Errorf("count at 30s = %d, want 3", n)
+	}
+	// the first bucket leaves the window after a minute
+	if n := c.count(at(59)); n != 3 {
+		t.Errorf("count at 59s = %d, want 3", n)
+	}
+	if n := c.count(at(60)); n != 1 {
+		t.Errorf("count at 60s = %d, want 1", n)
+	}
+	if n := c.count(at(90)); n != 0 {
+		t.Errorf("count at 90s = %d, want 0", n)
+	}
+
+	// an idle gap longer than the window empties every bucket
+	c.add(at(100))
+	if n := c.count(at(1000)); n != 0 {
+		t.Errorf("count after a long gap = %d, want 0", n)
+	}
+	c.add(at(1000))
+	if n := c.count(at(1000)); n != 1 {
+		t.Errorf("count after the gap = %d, want 1", n)
+	}
+}
+
+func TestAlertEvaluate(t *testing.T) {
+	rule := AlertRule{Counter: alertSpam, Threshold: 3, Window: time.Minute}
+	st := &alertState{AlertRule: rule, counter: newSlidingCounter(rule.Window)}
+	a := &Alerter{rules: []*alertState{st}, cooldown: 10 * time.Minute}
+	at := func(d time.Duration) time.Time { return alertEpoch.Add(d) }
+	burst := func(now time.Time, n int) {
+		for i := 0; i < n; i++ {
+			st.counter.add(now)
+		}
+	}
+	expect := func(now time.Time, want ...string) {
+		t.Helper()
+		var got []string
+		for _, n := range a.evaluate(now) {
+			got = append(got, n.Status)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("evaluate at %s = %v, want %v", now.Sub(alertEpoch), got, want)
+		}
+	}
+
+	burst(at(0), 2)
+	expect(at(0))
+
+	burst(at(time.Second), 2)
+	expect(at(time.Second), "firing")
+	if !st.firing || st.peak != 4 || !st.since.Equal(at(time.Second)) {
+		t.Errorf("firing state = %+v", st)
+	}
+	// still firing: no second notification
+	expect(at(10 * time.Second))
+
+	// below the threshold once the burst leaves the window
+	expect(at(2*time.Minute), "resolved")
+	if st.firing {
+		t.Error("still firing after recovery")
+	}
+	expect(at(3 * time.Minute))
+
+	// firing again within the cooldown is not notified until it ends
+	burst(at(5*time.Minute), 3)
+	expect(at(5 * time.Minute))
+	if !st.firing {
+		t.Error("not firing during the cooldown")
+	}
+	burst(at(10*time.Minute+30*time.Second), 3)
+	expect(at(10*time.Minute+30*time.Second), "firing")
+
+	expect(at(12*time.Minute), "resolved")
+
+	// a firing that was never notified recovers silently
+	burst(at(13*time.Minute), 3)
+	expect(at(13 * time.Minute))
+	if !st.firing {
+		t.Error("not firing during the cooldown")
+	}
+	expect(at(15 * time.Minute))
+	if st.firing {
+		t.Error("still firing after recovery")
+	}
+}
+
+func TestAlertOutputs(t *testing.T) {
+	t.Setenv("ALERT_ENABLED", "true")
+	t.Setenv("ALERT_OUTPUTS", `email, https://hooks.example.com/a?tags=spam\,alert ,https://hooks.example.com/b`)
+
+	a, err := NewAlerter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"https://hooks.example.com/a?tags=spam,alert", "https://hooks.example.com/b"}
+	if !a.email || !reflect.DeepEqual(a.webhooks, want) {
+		t.Errorf("email %v, webhooks %q, want true, %q", a.email, a.webhooks, want)
+	}
+}
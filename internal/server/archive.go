@@ -0,0 +1,128 @@
+package server
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/archive"
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/timearg"
+)
+
+// RunSubmissionsCommand implements "hugo-contact submissions".
+func RunSubmissionsCommand(args []string) int {
+	usage := `usage: hugo-contact submissions <command> [flags]
+
+commands:
+  list     show the most recent submissions
+  search   show submissions matching the filter flags
+  export   write matching submissions as CSV or JSONL
+  purge    delete submissions older than SUBMISSION_RETENTION_DAYS
+
+filter flags (list, search, export):
+  -email, -text, -form, -status, -since, -until, -limit
+  times are dates (2006-01-02), RFC 3339 timestamps or durations before now (24h, 7d)`
+
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	store := archive.New()
+
+	if args[0] == "purge" {
+		removed, err := store.Purge()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("Removed %d submissions\n", removed)
+		return 0
+	}
+
+	if args[0] != "list" && args[0] != "search" && args[0] != "export" {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("submissions "+args[0], flag.ContinueOnError)
+	var filter archive.Filter
+	var since, until, format, output string
+	fs.StringVar(&filter.Email, "email", "", "sender address contains")
+	fs.StringVar(&filter.Text, "text", "", "name, subject or message contains")
+	fs.StringVar(&filter.FormID, "form", "", "form ID")
+	fs.StringVar(&filter.Status, "status", "", "delivery status (pending, delivered, failed)")
+	fs.StringVar(&since, "since", "", "received at or after")
+	fs.StringVar(&until, "until", "", "received before")
+	fs.IntVar(&filter.Limit, "limit", 0, "maximum number of results")
+	fs.StringVar(&format, "format", "csv", "export format: csv or jsonl")
+	fs.StringVar(&output, "o", "", "export to file instead of stdout")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if args[0] == "list" && filter.Limit == 0 {
+		filter.Limit = 20
+	}
+
+	var err error
+	if filter.Since, err = timearg.Parse(since); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if filter.Until, err = timearg.Parse(until); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	subs, err := store.Search(filter)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if args[0] != "export" {
+		if len(subs) == 0 {
+			fmt.Println("No submissions found")
+			return 0
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "RECEIVED\tFORM\tSTATUS\tEMAIL\tNAME\tSUBJECT")
+		for _, s := range subs {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", s.ReceivedAt.Local().Format("2006-01-02 15:04"),
+				s.FormID, s.DeliveryStatus, s.Email, truncateForTable(s.Name, 30), truncateForTable(s.Subject, 40))
+		}
+		tw.Flush()
+		return 0
+	}
+
+	var w io.Writer = os.Stdout
+	if output != "" {
+		f, err := os.OpenFile(output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+
+	switch format {
+	case "csv":
+		err = archive.WriteCSV(w, subs)
+	case "jsonl":
+		err = archive.WriteJSONL(w, subs)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown export format %q\n", format)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if output != "" {
+		fmt.Printf("Exported %d submissions to %s\n", len(subs), output)
+	}
+	return 0
+}
@@ -0,0 +1,481 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	defaultBanThreshold   = 5
+	defaultBanWindow      = time.Hour
+	defaultBanDuration    = time.Hour
+	defaultBanMaxDuration = 7 * 24 * time.Hour
+	banSyncInterval       = 10 * time.Second
+)
+
+// BanRecord is the persisted state of one offending IP. A lifted or expired
+// ban keeps its record so the next ban escalates, until the offences are
+// forgotten after the maximum ban duration.
+type BanRecord struct {
+	IP        string    `json:"ip"`
+	Offences  int       `json:"offences"`
+	BannedAt  time.Time `json:"banned_at,omitzero"`
+	Until     time.Time `json:"until,omitzero"`
+	Reason    string    `json:"reason,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Active reports whether the ban is in force at the given time.
+func (b BanRecord) Active(now time.Time) bool {
+	return now.Before(b.Until)
+}
+
+// BanTracker is a fail2ban-style tracker: after threshold spam verdicts from
+// one IP within the window the IP is banned, for twice as long on every
+// repeated offence up to the maximum duration.
+type BanTracker struct {
+	mu          sync.Mutex
+	threshold   int
+	window      time.Duration
+	duration    time.Duration
+	maxDuration time.Duration
+	stateFile   string
+	stateMod    time.Time
+	hits        map[string][]time.Time
+	records     map[string]*BanRecord
+}
+
+// NewBanTracker returns a tracker configured from the BAN_* environment
+// variables, or nil when BAN_ENABLED is not "true".
+func NewBanTracker() (*BanTracker, error) {
+	if os.Getenv("BAN_ENABLED") != "true" {
+		return nil, nil
+	}
+
+	bt := &BanTracker{
+		threshold:   defaultBanThreshold,
+		window:      defaultBanWindow,
+		duration:    defaultBanDuration,
+		maxDuration: defaultBanMaxDuration,
+		stateFile:   os.Getenv("BAN_STATE_FILE"),
+		hits:        make(map[string][]time.Time),
+		records:     make(map[string]*BanRecord),
+	}
+
+	if env := os.Getenv("BAN_THRESHOLD"); env != "" {
+		n, err := strconv.Atoi(env)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid BAN_THRESHOLD %q", env)
+		}
+		bt.threshold = n
+	}
+	for _, opt := range []struct {
+		env string
+		dst *time.Duration
+	}{
+		{"BAN_WINDOW", &bt.window},
+		{"BAN_DURATION", &bt.duration},
+		{"BAN_MAX_DURATION", &bt.maxDuration},
+	} {
+		if env := os.Getenv(opt.env); env != "" {
+			d, err := time.ParseDuration(env)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid %s %q", opt.env, env)
+			}
+			*opt.dst = d
+		}
+	}
+	if bt.maxDuration < bt.duration {
+		bt.maxDuration = bt.duration
+	}
+
+	if bt.stateFile != "" {
+		bt.mu.Lock()
+		err := bt.syncLocked()
+		bt.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return bt, nil
+}
+
+// RecordSpam counts a spam verdict against the IP and bans it once the
+// threshold is reached. It returns the new ban, if one was issued.
+func (bt *BanTracker) RecordSpam(clientIP, reason string) (BanRecord, bool) {
+	ip := banKey(clientIP)
+	now := time.Now()
+
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+
+	if rec, ok := bt.records[ip]; ok && rec.Active(now) {
+		return BanRecord{}, false
+	}
+
+	cutoff := now.Add(-bt.window)
+	hits := bt.hits[ip][:0]
+	for _, t := range bt.hits[ip] {
+		if t.After(cutoff) {
+			hits = append(hits, t)
+		}
+	}
+	hits = append(hits, now)
+	if len(hits) < bt.threshold {
+		bt.hits[ip] = hits
+		return BanRecord{}, false
+	}
+
+	return bt.banLocked(ip, reason, now), true
+}
+
+// Ban bans the IP immediately, as an administrative action. The duration
+// escalates like an automatic ban.
+func (bt *BanTracker) Ban(clientIP, reason string) BanRecord {
+	ip := banKey(clientIP)
+	now := time.Now()
+
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+
+	if rec, ok := bt.records[ip]; ok && rec.Active(now) {
+		return *rec
+	}
+	return bt.banLocked(ip, reason, now)
+}
+
+func (bt *BanTracker) banLocked(ip, reason string, now time.Time) BanRecord {
+	if bt.stateFile != "" {
+		// a lift by the bans command resets the offences to escalate from
+		if _, err := bt.refreshLocked(); err != nil {
+			logger.Error("Failed to read ban state", slog.String("error", err.Error()))
+		}
+	}
+
+	rec, ok := bt.records[ip]
+	if !ok || now.Sub(rec.Until) > bt.maxDuration {
+		rec = &BanRecord{IP: ip}
+		bt.records[ip] = rec
+	}
+	rec.Offences++
+	rec.BannedAt = now
+	rec.Until = now.Add(bt.banDuration(rec.Offences))
+	rec.Reason = reason
+	rec.UpdatedAt = now
+	delete(bt.hits, ip)
+
+	bt.persistLocked()
+	return *rec
+}
+
+// banDuration doubles the base duration for every previous offence.
+func (bt *BanTracker) banDuration(offences int) time.Duration {
+	d := bt.duration
+	for i := 1; i < offences && d < bt.maxDuration; i++ {
+		d *= 2
+	}
+	if d > bt.maxDuration {
+		d = bt.maxDuration
+	}
+	return d
+}
+
+// IsBanned reports whether the IP is currently banned.
+func (bt *BanTracker) IsBanned(clientIP string) (BanRecord, bool) {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+
+	rec, ok := bt.records[banKey(clientIP)]
+	if !ok || !rec.Active(time.Now()) {
+		return BanRecord{}, false
+	}
+	return *rec, true
+}
+
+// List returns the active bans, soonest expiry first.
+func (bt *BanTracker) List() []BanRecord {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+
+	return activeBans(bt.records, time.Now())
+}
+
+// Lift ends the ban for the IP and forgets its offences. It reports whether
+// the IP was banned.
+func (bt *BanTracker) Lift(clientIP string) bool {
+	ip := banKey(clientIP)
+
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+
+	rec, ok := bt.records[ip]
+	if !ok || !rec.Active(time.Now()) {
+		return false
+	}
+	liftBan(rec)
+	delete(bt.hits, ip)
+	bt.persistLocked()
+	return true
+}
+
+// Watch periodically prunes expired state and merges changes made to the
+// state file by the bans command. SIGHUP forces an immediate merge.
+func (bt *BanTracker) Watch() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	ticker := time.NewTicker(banSyncInterval)
+
+	go func() {
+		for {
+			select {
+			case <-hup:
+			case <-ticker.C:
+			}
+			bt.mu.Lock()
+			bt.pruneLocked(time.Now())
+			if bt.stateFile != "" {
+				if err := bt.syncLocked(); err != nil {
+					logger.Error("Failed to sync ban state", slog.String("error", err.Error()))
+				}
+			}
+			bt.mu.Unlock()
+		}
+	}()
+}
+
+// Close writes the final state so bans survive a restart.
+func (bt *BanTracker) Close() error {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+
+	if bt.stateFile == "" {
+		return nil
+	}
+	bt.pruneLocked(time.Now())
+	return bt.syncLocked()
+}
+
+func (bt *BanTracker) pruneLocked(now time.Time) {
+	cutoff := now.Add(-bt.window)
+	for ip, hits := range bt.hits {
+		if len(hits) == 0 || !hits[len(hits)-1].After(cutoff) {
+			delete(bt.hits, ip)
+		}
+	}
+	for ip, rec := range bt.records {
+		if now.Sub(rec.Until) > bt.maxDuration && now.Sub(rec.UpdatedAt) > bt.maxDuration {
+			delete(bt.records, ip)
+		}
+	}
+}
+
+// syncLocked merges the state file into memory if it was modified by someone
+// else and writes the merged state back.
+func (bt *BanTracker) syncLocked() error {
+	changed, err := bt.refreshLocked()
+	if err != nil {
+		return err
+	}
+	if changed {
+		bt.persistLocked()
+	}
+	return nil
+}
+
+// refreshLocked reads the state file if it changed since it was last read or
+// written, keeping the most recently updated record for each IP. It reports
+// whether the file had changed.
+func (bt *BanTracker) refreshLocked() (bool, error) {
+	info, err := os.Stat(bt.stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if info.ModTime().Equal(bt.stateMod) {
+		return false, nil
+	}
+
+	records, err := readBanState(bt.stateFile)
+	if err != nil {
+		return false, err
+	}
+	for ip, rec := range records {
+		if cur, ok := bt.records[ip]; !ok || rec.UpdatedAt.After(cur.UpdatedAt) {
+			bt.records[ip] = rec
+			if !rec.Active(time.Now()) {
+				delete(bt.hits, ip)
+			}
+		}
+	}
+	bt.stateMod = info.ModTime()
+	return true, nil
+}
+
+// persistLocked writes the state file. Changes made by the bans command since
+// the last sync are merged first so that writing does not undo them.
+func (bt *BanTracker) persistLocked() {
+	if bt.stateFile == "" {
+		return
+	}
+	if _, err := bt.refreshLocked(); err != nil {
+		logger.Error("Failed to read ban state", slog.String("error", err.Error()))
+	}
+	if err := writeBanState(bt.stateFile, bt.records); err != nil {
+		logger.Error("Failed to persist ban state", slog.String("error", err.Error()))
+		return
+	}
+	if info, err := os.Stat(bt.stateFile); err == nil {
+		bt.stateMod = info.ModTime()
+	}
+}
+
+func liftBan(rec *BanRecord) {
+	rec.Offences = 0
+	rec.Until = time.Time{}
+	rec.Reason = "lifted"
+	rec.UpdatedAt = time.Now()
+}
+
+func activeBans(records map[string]*BanRecord, now time.Time) []BanRecord {
+	var bans []BanRecord
+	for _, rec := range records {
+		if rec.Active(now) {
+			bans = append(bans, *rec)
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Until.Before(bans[j].Until)
+	})
+	return bans
+}
+
+// banKey normalises the client IP so that the same address with different
+// ports or IPv4-mapped notation shares one record.
+func banKey(clientIP string) string {
+	if addr, ok := parseClientAddr(clientIP); ok {
+		return addr.String()
+	}
+	return clientIP
+}
+
+func readBanState(filename string) (map[string]*BanRecord, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ban state: %w", err)
+	}
+
+	var list []BanRecord
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, fmt.Errorf("failed to parse ban state: %w", err)
+		}
+	}
+
+	records := make(map[string]*BanRecord, len(list))
+	for i := range list {
+		records[list[i].IP] = &list[i]
+	}
+	return records, nil
+}
+
+// writeBanState replaces the state file atomically.
+func writeBanState(filename string, records map[string]*BanRecord) error {
+	list := make([]BanRecord, 0, len(records))
+	for _, rec := range records {
+		list = append(list, *rec)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].IP < list[j].IP })
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write ban state: %w", err)
+	}
+	return os.Rename(tmp, filename)
+}
+
+// RunBansCommand implements "hugo-contact bans list|lift <ip>". It works on
+// BAN_STATE_FILE; a running server merges the change on its next sync or
+// immediately on SIGHUP.
+func RunBansCommand(args []string) int {
+	usage := "usage: hugo-contact bans list | hugo-contact bans lift <ip>"
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	stateFile := os.Getenv("BAN_STATE_FILE")
+	if stateFile == "" {
+		fmt.Fprintln(os.Stderr, "BAN_STATE_FILE is not set; bans are only kept in the server's memory")
+		return 1
+	}
+
+	records := map[string]*BanRecord{}
+	if _, err := os.Stat(stateFile); err == nil {
+		records, err = readBanState(stateFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	switch args[0] {
+	case "list":
+		bans := activeBans(records, time.Now())
+		if len(bans) == 0 {
+			fmt.Println("No active bans")
+			return 0
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "IP\tOFFENCES\tBANNED AT\tUNTIL\tREASON")
+		for _, b := range bans {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", b.IP, b.Offences,
+				b.BannedAt.Local().Format(time.RFC3339), b.Until.Local().Format(time.RFC3339), b.Reason)
+		}
+		tw.Flush()
+		return 0
+
+	case "lift":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, usage)
+			return 2
+		}
+		ip := banKey(args[1])
+		rec, ok := records[ip]
+		if !ok || !rec.Active(time.Now()) {
+			fmt.Fprintf(os.Stderr, "%s is not banned\n", ip)
+			return 1
+		}
+		liftBan(rec)
+		if err := writeBanState(stateFile, records); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("Lifted ban for %s\n", ip)
+		return 0
+	}
+
+	fmt.Fprintln(os.Stderr, usage)
+	return 2
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultCaptchaTimeout = 5 * time.Second
+
+	turnstileVerifyURL       = "https://challenges.cloudflare.com/turnstile/v0/siteverify"
+	hcaptchaVerifyURL        = "https://api.hcaptcha.com/siteverify"
+	recaptchaVerifyURL       = "https://www.google.com/recaptcha/api/siteverify"
+	friendlyCaptchaVerifyURL = "https://api.friendlycaptcha.com/api/v1/siteverify"
+)
+
+// CaptchaResult is the outcome of a successful round trip to the provider.
+// Success is false when the provider rejected the response.
+type CaptchaResult struct {
+	Success    bool
+	Score      float64
+	HasScore   bool // the provider returned a score, which may be 0
+	Hostname   string
+	ErrorCodes []string
+}
+
+// CaptchaVerifier checks a CAPTCHA response submitted with a form. An error
+// means the provider could not be asked (network, timeout, bad reply), which
+// is handled by the per-form fail-open/fail-closed policy.
+type CaptchaVerifier interface {
+	Provider() string
+	ResponseField() string
+	Verify(ctx context.Context, response, remoteIP string) (CaptchaResult, error)
+}
+
+// siteverifyVerifier implements the form-encoded siteverify protocol shared
+// by Turnstile, hCaptcha and reCAPTCHA.
+type siteverifyVerifier struct {
+	provider  string
+	field     string
+	verifyURL string
+	secret    string
+	siteKey   string
+	minScore  float64
+	client    *http.Client
+}
+
+type siteverifyResponse struct {
+	Success    bool     `json:"success"`
+	Score      *float64 `json:"score"`
+	Hostname   string   `json:"hostname"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+func (v *siteverifyVerifier) Provider() string      { return v.provider }
+func (v *siteverifyVerifier) ResponseField() string { return v.field }
+
+func (v *siteverifyVerifier) Verify(ctx context.Context, response, remoteIP string) (CaptchaResult, error) {
+	form := url.Values{}
+	form.Set("secret", v.secret)
+	form.Set("response", response)
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	if v.siteKey != "" && v.provider == "hcaptcha" {
+		form.Set("sitekey", v.siteKey)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return CaptchaResult{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var body siteverifyResponse
+	if err := doCaptchaRequest(v.client, req, &body); err != nil {
+		return CaptchaResult{}, err
+	}
+
+	result := CaptchaResult{
+		Success:    body.Success,
+		Hostname:   body.Hostname,
+		ErrorCodes: body.ErrorCodes,
+	}
+	// reCAPTCHA v3 returns a score instead of a plain pass/fail
+	if body.Score != nil {
+		result.Score = *body.Score
+		result.HasScore = true
+		if result.Success && v.minScore > 0 && result.Score < v.minScore {
+			result.Success = false
+			result.ErrorCodes = append(result.ErrorCodes, "score-below-threshold")
+		}
+	}
+	return result, nil
+}
+
+// friendlyCaptchaVerifier implements the JSON siteverify API of Friendly Captcha.
+type friendlyCaptchaVerifier struct {
+	verifyURL string
+	secret    string
+	siteKey   string
+	client    *http.Client
+}
+
+func (v *friendlyCaptchaVerifier) Provider() string      { return "friendlycaptcha" }
+func (v *friendlyCaptchaVerifier) ResponseField() string { return "frc-captcha-solution" }
+
+func (v *friendlyCaptchaVerifier) Verify(ctx context.Context, response, remoteIP string) (CaptchaResult, error) {
+	payload, err := json.Marshal(map[string]string{
+		"solution": response,
+		"secret":   v.secret,
+		"sitekey":  v.siteKey,
+	})
+	if err != nil {
+		return CaptchaResult{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.verifyURL, bytes.NewReader(payload))
+	if err != nil {
+		return CaptchaResult{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var body struct {
+		Success bool     `json:"success"`
+		Errors  []string `json:"errors"`
+	}
+	if err := doCaptchaRequest(v.client, req, &body); err != nil {
+		return CaptchaResult{}, err
+	}
+
+	return CaptchaResult{Success: body.Success, ErrorCodes: body.Errors}, nil
+}
+
+func doCaptchaRequest(client *http.Client, req *http.Request, out interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("captcha request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Providers answer rejected tokens with 200 (and Friendly Captcha with 4xx
+	// plus a JSON body), so only server errors count as unavailability
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("captcha provider returned status %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode captcha response: %w", err)
+	}
+	return nil
+}
+
+// NewCaptchaVerifier builds the verifier configured by CAPTCHA_PROVIDER.
+// It returns nil without error when no provider is configured.
+func NewCaptchaVerifier() (CaptchaVerifier, error) {
+	provider := strings.ToLower(strings.TrimSpace(os.Getenv("CAPTCHA_PROVIDER")))
+	if provider == "" || provider == "none" {
+		return nil, nil
+	}
+
+	secret := os.Getenv("CAPTCHA_SECRET")
+	if secret == "" {
+		return nil, fmt.Errorf("CAPTCHA_SECRET is required when CAPTCHA_PROVIDER is set")
+	}
+	siteKey := os.Getenv("CAPTCHA_SITE_KEY")
+	verifyURL := os.Getenv("CAPTCHA_VERIFY_URL")
+
+	timeout := defaultCaptchaTimeout
+	if envTimeout := os.Getenv("CAPTCHA_TIMEOUT"); envTimeout != "" {
+		d, err := time.ParseDuration(envTimeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid CAPTCHA_TIMEOUT %q", envTimeout)
+		}
+		timeout = d
+	}
+	client := &http.Client{Timeout: timeout}
+
+	var minScore float64
+	if envScore := os.Getenv("CAPTCHA_MIN_SCORE"); envScore != "" {
+		score, err := strconv.ParseFloat(envScore, 64)
+		if err != nil || score < 0 || score > 1 {
+			return nil, fmt.Errorf("invalid CAPTCHA_MIN_SCORE %q", envScore)
+		}
+		minScore = score
+	}
+
+	switch provider {
+	case "turnstile":
+		return &siteverifyVerifier{
+			provider:  provider,
+			field:     "cf-turnstile-response",
+			verifyURL: orDefault(verifyURL, turnstileVerifyURL),
+			secret:    secret,
+			client:    client,
+		}, nil
+	case "hcaptcha":
+		return &siteverifyVerifier{
+			provider:  provider,
+			field:     "h-captcha-response",
+			verifyURL: orDefault(verifyURL, hcaptchaVerifyURL),
+			secret:    secret,
+			siteKey:   siteKey,
+			client:    client,
+		}, nil
+	case "recaptcha":
+		return &siteverifyVerifier{
+			provider:  provider,
+			field:     "g-recaptcha-response",
+			verifyURL: orDefault(verifyURL, recaptchaVerifyURL),
+			secret:    secret,
+			minScore:  minScore,
+			client:    client,
+		}, nil
+	case "friendlycaptcha":
+		if siteKey == "" {
+			return nil, fmt.Errorf("CAPTCHA_SITE_KEY is required for friendlycaptcha")
+		}
+		return &friendlyCaptchaVerifier{
+			verifyURL: orDefault(verifyURL, friendlyCaptchaVerifyURL),
+			secret:    secret,
+			siteKey:   siteKey,
+			client:    client,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown CAPTCHA_PROVIDER %q", provider)
+}
+
+// captchaFailOpen reports whether a form should accept submissions when the
+// provider cannot be reached. CAPTCHA_FAIL_POLICY_<FORM> overrides the
+// global CAPTCHA_FAIL_POLICY; the default is to fail closed.
+func captchaFailOpen(formID string) bool {
+	policy := os.Getenv("CAPTCHA_FAIL_POLICY_" + envSuffix(formID))
+	if policy == "" {
+		policy = os.Getenv("CAPTCHA_FAIL_POLICY")
+	}
+	return strings.EqualFold(strings.TrimSpace(policy), "open")
+}
+
+// envSuffix turns a form ID into the upper-case suffix used for per-form
+// environment variables, e.g. "contact-us" becomes "CONTACT_US".
+func envSuffix(formID string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, formID)
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
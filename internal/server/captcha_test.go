@@ -0,0 +1,232 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/archive"
+)
+
+// captchaStub runs a provider that answers every request with status and
+// body, and returns the form values or JSON fields it was sent.
+func captchaStub(t *testing.T, status int, body string) (url string, sent func() map[string]string) {
+	t.Helper()
+	got := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") == "application/json" {
+			json.NewDecoder(r.Body).Decode(&got)
+		} else {
+			r.ParseForm()
+			for key := range r.PostForm {
+				got[key] = r.PostForm.Get(key)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, func() map[string]string { return got }
+}
+
+func TestCaptchaVerify(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		minScore string
+		status   int
+		body     string
+		want     CaptchaResult
+		wantSent map[string]string
+	}{
+		{
+			name:     "success",
+			provider: "turnstile",
+			status:   http.StatusOK,
+			body:     `{"success":true,"hostname":"example.com"}`,
+			want:     CaptchaResult{Success: true, Hostname: "example.com"},
+			wantSent: map[string]string{"secret": "secret", "response": "token", "remoteip": "192.0.2.1"},
+		},
+		{
+			name:     "failure",
+			provider: "turnstile",
+			status:   http.StatusOK,
+			body:     `{"success":false,"error-codes":["invalid-input-response"]}`,
+			want:     CaptchaResult{ErrorCodes: []string{"invalid-input-response"}},
+		},
+		{
+			name:     "hcaptcha site key",
+			provider: "hcaptcha",
+			status:   http.StatusOK,
+			body:     `{"success":true}`,
+			want:     CaptchaResult{Success: true},
+			wantSent: map[string]string{"secret": "secret", "response": "token", "remoteip": "192.0.2.1", "sitekey": "site"},
+		},
+		{
+			name:     "score above minimum",
+			provider: "recaptcha",
+			minScore: "0.5",
+			status:   http.StatusOK,
+			body:     `{"success":true,"score":0.9}`,
+			want:     CaptchaResult{Success: true, Score: 0.9, HasScore: true},
+		},
+		{
+			name:     "score below minimum",
+			provider: "recaptcha",
+			minScore: "0.5",
+			status:   http.StatusOK,
+			body:     `{"success":true,"score":0.1}`,
+			want:     CaptchaResult{Score: 0.1, HasScore: true, ErrorCodes: []string{"score-below-threshold"}},
+		},
+		{
+			name:     "zero score",
+			provider: "recaptcha",
+			status:   http.StatusOK,
+			body:     `{"success":true,"score":0}`,
+			want:     CaptchaResult{Success: true, HasScore: true},
+		},
+		{
+			name:     "friendlycaptcha success",
+			provider: "friendlycaptcha",
+			status:   http.StatusOK,
+			body:     `{"success":true}`,
+			want:     CaptchaResult{Success: true},
+			wantSent: map[string]string{"solution": "token", "secret": "secret", "sitekey": "site"},
+		},
+		{
+			name:     "friendlycaptcha rejected with 400",
+			provider: "friendlycaptcha",
+			status:   http.StatusBadRequest,
+			body:     `{"success":false,"errors":["solution_invalid"]}`,
+			want:     CaptchaResult{ErrorCodes: []string{"solution_invalid"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url, sent := captchaStub(t, tt.status, tt.body)
+			t.Setenv("CAPTCHA_PROVIDER", tt.provider)
+			t.Setenv("CAPTCHA_SECRET", "secret")
+			t.Setenv("CAPTCHA_SITE_KEY", "site")
+			t.Setenv("CAPTCHA_VERIFY_URL", url)
+			t.Setenv("CAPTCHA_MIN_SCORE", tt.minScore)
+
+			v, err := NewCaptchaVerifier()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := v.Verify(context.Background(), "token", "192.0.2.1")
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Verify = %+v, want %+v", got, tt.want)
+			}
+			if tt.wantSent != nil && !reflect.DeepEqual(sent(), tt.wantSent) {
+				t.Errorf("sent %v, want %v", sent(), tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestCaptchaProviderDown(t *testing.T) {
+	for _, provider := range []string{"turnstile", "friendlycaptcha"} {
+		t.Run(provider, func(t *testing.T) {
+			url, _ := captchaStub(t, http.StatusServiceUnavailable, `{"success":false}`)
+			t.Setenv("CAPTCHA_PROVIDER", provider)
+			t.Setenv("CAPTCHA_SECRET", "secret")
+			t.Setenv("CAPTCHA_SITE_KEY", "site")
+			t.Setenv("CAPTCHA_VERIFY_URL", url)
+
+			v, err := NewCaptchaVerifier()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// an error rather than a rejection, so the fail policy applies
+			if _, err := v.Verify(context.Background(), "token", ""); err == nil {
+				t.Error("Verify succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestCaptchaFailOpen(t *testing.T) {
+	t.Setenv("CAPTCHA_FAIL_POLICY", "open")
+	t.Setenv("CAPTCHA_FAIL_POLICY_CONTACT_US", "closed")
+
+	if captchaFailOpen("contact-us") {
+		t.Error("contact-us fails open, want its own closed policy")
+	}
+	if !captchaFailOpen("newsletter") {
+		t.Error("newsletter fails closed, want the global open policy")
+	}
+}
+
+func TestCheckCaptchaRecord(t *testing.T) {
+	score := 0.9
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   *archive.Captcha
+	}{
+		{
+			name:   "passed",
+			status: http.StatusOK,
+			body:   `{"success":true,"score":0.9,"hostname":"example.com"}`,
+			want:   &archive.Captcha{Provider: "recaptcha", Result: archive.CaptchaPassed, Score: &score, Hostname: "example.com"},
+		},
+		{
+			name:   "provider down, fail-open",
+			status: http.StatusServiceUnavailable,
+			body:   `{"success":false}`,
+			want:   &archive.Captcha{Provider: "recaptcha", Result: archive.CaptchaFailOpen},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url, _ := captchaStub(t, tt.status, tt.body)
+			t.Setenv("CAPTCHA_PROVIDER", "recaptcha")
+			t.Setenv("CAPTCHA_SECRET", "secret")
+			t.Setenv("CAPTCHA_VERIFY_URL", url)
+			t.Setenv("CAPTCHA_FAIL_POLICY", "open")
+
+			v, err := NewCaptchaVerifier()
+			if err != nil {
+				t.Fatal(err)
+			}
+			captchaVerifier = v
+			t.Cleanup(func() { captchaVerifier = nil })
+
+			r := postForm("/f/contact", "g-recaptcha-response=token")
+			got, ok := checkCaptcha(httptest.NewRecorder(), r, "192.0.2.1")
+			if !ok {
+				t.Fatal("submission rejected")
+			}
+			if got == nil {
+				t.Fatal("no CAPTCHA record")
+			}
+			if tt.want.Result == archive.CaptchaFailOpen && got.Error == "" {
+				t.Error("fail-open record without the provider error")
+			}
+			got.Error = ""
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checkCaptcha = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// postForm returns a submission of the URL-encoded body to path.
+func postForm(path, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.ParseForm()
+	return r
+}
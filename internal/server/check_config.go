@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/mail"
+)
+
+// CheckConfig implements "hugo-contact check-config". It validates the
+// environment the way serve would, without opening listeners or starting
+// background work. With -smtp it also logs in to the mail server.
+func CheckConfig(args []string) int {
+	fs := flag.NewFlagSet("check-config", flag.ContinueOnError)
+	withSMTP := fs.Bool("smtp", false, "connect and authenticate to the SMTP server")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	// readable output; configure logs what it enables
+	logger = slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	if err := configure(); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+
+	var problems []string
+	if err := mail.ConfigFromEnv().Validate(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	listen := serverListen
+	if listen.acme != nil {
+		if err := os.MkdirAll(listen.acme.CacheDir, 0700); err != nil {
+			problems = append(problems, "invalid ACME cache directory: "+err.Error())
+		}
+	} else if listen.https {
+		if _, err := NewCertStoreFromEnv(); err != nil {
+			problems = append(problems, "invalid HTTPS certificate: "+err.Error())
+		}
+	}
+	if _, err := newTLSConfig(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if os.Getenv("ADMIN_LISTEN_ADDR") != "" || os.Getenv("ADMIN_PATH_PREFIX") != "" {
+		if _, err := NewAdminAuth(); err != nil {
+			problems = append(problems, "invalid admin API configuration: "+err.Error())
+		}
+	}
+	if os.Getenv("ADMIN_LISTEN_ADDR") != "" {
+		// stands in for the form server's certificate
+		var serverCert func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+		if listen.https {
+			serverCert = func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return nil, nil }
+		}
+		if _, _, err := newAdminTLSConfig(serverCert); err != nil {
+			problems = append(problems, "invalid admin TLS configuration: "+err.Error())
+		}
+	}
+
+	if *withSMTP && len(problems) == 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		detail, err := checkSMTP(ctx)
+		cancel()
+		if err != nil {
+			problems = append(problems, "SMTP login failed: "+err.Error())
+		} else {
+			logger.Info("SMTP login succeeded", slog.String("server", detail))
+		}
+	}
+
+	if len(problems) > 0 {
+		fmt.Fprintln(os.Stderr, "error: "+strings.Join(problems, "\nerror: "))
+		return 1
+	}
+	fmt.Println("Configuration OK")
+	return 0
+}
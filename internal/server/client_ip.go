@@ -0,0 +1,89 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// trustedProxies lists the reverse proxies whose X-Forwarded-For and
+// X-Real-IP headers are believed. It is empty unless TRUSTED_PROXIES is set.
+var trustedProxies []netip.Prefix
+
+// parseTrustedProxies reads a comma-separated list of IPs and CIDRs.
+func parseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		prefix, err := parseIPOrCIDR(field)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+// loadTrustedProxies configures trustedProxies from TRUSTED_PROXIES.
+func loadTrustedProxies() error {
+	prefixes, err := parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		return fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+	trustedProxies = prefixes
+	return nil
+}
+
+func isTrustedProxy(addr netip.Addr) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// getClientIP returns the address of the client that sent the request,
+// without a port. Forwarding headers are only honoured when the connection
+// comes from a trusted proxy; X-Forwarded-For is then walked from the right
+// and the first hop that is not itself a trusted proxy is used, so a client
+// cannot choose its address by sending the header itself.
+func getClientIP(r *http.Request) string {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+
+	addr, err := netip.ParseAddr(remote)
+	if err != nil || !isTrustedProxy(addr.Unmap()) {
+		return remote
+	}
+
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				// A malformed hop was not written by a trusted proxy, so
+				// nothing left of it can be believed either.
+				break
+			}
+			hop = hop.Unmap()
+			if !isTrustedProxy(hop) || i == 0 {
+				return hop.String()
+			}
+		}
+		return remote
+	}
+
+	if rip, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return rip.Unmap().String()
+	}
+	return remote
+}
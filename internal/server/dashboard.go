@@ -0,0 +1,331 @@
+package server
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/archive"
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/spamlog"
+)
+
+//go:embed dashboard
+var dashboardFS embed.FS
+
+var dashboardTemplate = template.Must(template.New("index.html").Funcs(template.FuncMap{
+	"datetime": func(t time.Time) string { return t.Local().Format("Jan 2 15:04") },
+}).ParseFS(dashboardFS, "dashboard/index.html"))
+
+const dashboardTopN = 10
+
+// dashboardCount is one row of a grouped count table.
+type dashboardCount struct {
+	Key      string
+	Count    int
+	LastSeen time.Time
+	Banned   bool
+}
+
+// dashboardBar is one bar of the hourly volume chart, with its geometry
+// precomputed so the template only has to place it.
+type dashboardBar struct {
+	Label      string
+	Spam       int
+	Accepted   int
+	X          int
+	SpamY      int
+	SpamH      int
+	AcceptedY  int
+	AcceptedH  int
+	ShowLabel  bool
+	LabelX     int
+	TitleCount string
+}
+
+type dashboardData struct {
+	Generated      time.Time
+	Flash          string
+	SpamEnabled    bool
+	ArchiveEnabled bool
+	QuarantineOn   bool
+	BansEnabled    bool
+	SpamTotal      int
+	AcceptedTotal  int
+	FailedTotal    int
+	Bars           []dashboardBar
+	ChartMax       int
+	ByReason       []dashboardCount
+	ByIP           []dashboardCount
+	Submissions    []archive.Submission
+	Quarantine     []QuarantineItem
+	Bans           []BanRecord
+	Errors         []string
+}
+
+// Chart geometry in SVG user units.
+const (
+	chartHeight = 160
+	chartBarW   = 20
+	chartGap    = 4
+	chartTop    = 10
+)
+
+// registerDashboard adds the dashboard to the admin mux. It relies on the
+// admin authentication; basic-auth users can log in from a browser.
+func registerDashboard(mux *http.ServeMux, auth *AdminAuth) {
+	static, _ := fs.Sub(dashboardFS, "dashboard/static")
+
+	mux.Handle("GET /dashboard/static/", http.StripPrefix("/dashboard/static/", http.FileServerFS(static)))
+	mux.Handle("GET /dashboard/{$}", adminAuthMiddleware(auth, http.HandlerFunc(dashboardHandler)))
+	mux.Handle("POST /dashboard/actions", adminAuthMiddleware(auth, http.HandlerFunc(dashboardActionHandler)))
+	mux.Handle("GET /{$}", http.RedirectHandler("dashboard/", http.StatusFound))
+}
+
+func dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	data := dashboardData{
+		Generated:      now,
+		Flash:          r.URL.Query().Get("msg"),
+		SpamEnabled:    spamLogger != nil,
+		ArchiveEnabled: submissionArchive != nil,
+		QuarantineOn:   quarantineStore != nil,
+		BansEnabled:    banTracker != nil,
+	}
+
+	reader := spamLogger
+	if reader == nil {
+		reader = spamlog.New()
+	}
+	spam, err := reader.Recent(24)
+	if err != nil {
+		data.Errors = append(data.Errors, "spam log: "+err.Error())
+	}
+	data.SpamTotal = len(spam)
+
+	var accepted []archive.Submission
+	if submissionArchive != nil {
+		accepted, err = submissionArchive.Search(archive.Filter{Since: now.Add(-24 * time.Hour)})
+		if err != nil {
+			data.Errors = append(data.Errors, "submission archive: "+err.Error())
+		}
+		data.AcceptedTotal = len(accepted)
+		for _, sub := range accepted {
+			if sub.DeliveryStatus == archive.DeliveryFailed {
+				data.FailedTotal++
+			}
+		}
+		if len(accepted) > 20 {
+			data.Submissions = accepted[:20]
+		} else {
+			data.Submissions = accepted
+		}
+	}
+
+	if quarantineStore != nil {
+		data.Quarantine, err = quarantineStore.List(QuarantinePending)
+		if err != nil {
+			data.Errors = append(data.Errors, "quarantine: "+err.Error())
+		}
+	}
+	if banTracker != nil {
+		data.Bans = banTracker.List()
+	}
+
+	data.ByReason, data.ByIP = groupSpam(spam)
+	for i := range data.ByIP {
+		if banTracker != nil {
+			_, data.ByIP[i].Banned = banTracker.IsBanned(data.ByIP[i].Key)
+		}
+	}
+	data.Bars, data.ChartMax = hourlyBars(now, spam, accepted)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; style-src 'self'; img-src 'self' data:; form-action 'self'; frame-ancestors 'none'")
+	if err := dashboardTemplate.Execute(w, data); err != nil {
+		logger.Error("Failed to render dashboard", slog.String("error", err.Error()))
+	}
+}
+
+// groupSpam counts spam entries by reason and by normalised client IP,
+// largest first.
+func groupSpam(entries []spamlog.Entry) (byReason, byIP []dashboardCount) {
+	reasons := map[string]*dashboardCount{}
+	ips := map[string]*dashboardCount{}
+
+	for _, entry := range entries {
+		for _, group := range []struct {
+			m   map[string]*dashboardCount
+			key string
+		}{
+			{reasons, entry.Reason},
+			{ips, banKey(entry.ClientIP)},
+		} {
+			c, ok := group.m[group.key]
+			if !ok {
+				c = &dashboardCount{Key: group.key}
+				group.m[group.key] = c
+			}
+			c.Count++
+			if entry.Timestamp.After(c.LastSeen) {
+				c.LastSeen = entry.Timestamp
+			}
+		}
+	}
+
+	return topCounts(reasons), topCounts(ips)
+}
+
+func topCounts(m map[string]*dashboardCount) []dashboardCount {
+	counts := make([]dashboardCount, 0, len(m))
+	for _, c := range m {
+		counts = append(counts, *c)
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Key < counts[j].Key
+	})
+	if len(counts) > dashboardTopN {
+		counts = counts[:dashboardTopN]
+	}
+	return counts
+}
+
+// hourlyBars buckets the last 24 hours into stacked bars of spam and
+// accepted submissions.
+func hourlyBars(now time.Time, spam []spamlog.Entry, accepted []archive.Submission) ([]dashboardBar, int) {
+	end := now.Truncate(time.Hour).Add(time.Hour)
+	start := end.Add(-24 * time.Hour)
+
+	bars := make([]dashboardBar, 24)
+	for i := range bars {
+		bars[i].Label = start.Add(time.Duration(i) * time.Hour).Local().Format("15:00")
+	}
+	bucket := func(t time.Time) int {
+		if t.Before(start) || !t.Before(end) {
+			return -1
+		}
+		return int(t.Sub(start) / time.Hour)
+	}
+	for _, entry := range spam {
+		if i := bucket(entry.Timestamp); i >= 0 {
+			bars[i].Spam++
+		}
+	}
+	for _, sub := range accepted {
+		if i := bucket(sub.ReceivedAt); i >= 0 {
+			bars[i].Accepted++
+		}
+	}
+
+	maxTotal := 0
+	for _, bar := range bars {
+		if total := bar.Spam + bar.Accepted; total > maxTotal {
+			maxTotal = total
+		}
+	}
+	scale := 1
+	if maxTotal > 0 {
+		scale = maxTotal
+	}
+
+	for i := range bars {
+		bar := &bars[i]
+		bar.X = i * (chartBarW + chartGap)
+		bar.AcceptedH = bar.Accepted * chartHeight / scale
+		bar.SpamH = bar.Spam * chartHeight / scale
+		bar.AcceptedY = chartTop + chartHeight - bar.AcceptedH
+		bar.SpamY = bar.AcceptedY - bar.SpamH
+		bar.ShowLabel = i%3 == 0
+		bar.LabelX = bar.X + chartBarW/2
+		bar.TitleCount = fmt.Sprintf("%s: %d spam, %d accepted", bar.Label, bar.Spam, bar.Accepted)
+	}
+	return bars, maxTotal
+}
+
+// dashboardActionHandler performs the one-click actions and redirects back
+// to the dashboard with a flash message.
+func dashboardActionHandler(w http.ResponseWriter, r *http.Request) {
+	if !sameOrigin(r) {
+		writeAdminError(w, http.StatusForbidden, "cross-origin request rejected")
+		return
+	}
+	_ = r.ParseForm()
+
+	action := r.PostFormValue("action")
+	target := r.PostFormValue("target")
+	var msg string
+	var err error
+
+	switch action {
+	case "release", "spam":
+		if quarantineStore == nil {
+			err = errors.New("quarantine is not enabled")
+			break
+		}
+		var item QuarantineItem
+		if action == "release" {
+			item, err = quarantineStore.Release(target)
+		} else {
+			item, err = quarantineStore.MarkSpam(target)
+		}
+		if err == nil {
+			msg = fmt.Sprintf("Item from %s marked as %s", item.Email, item.Status)
+		}
+	case "ban":
+		if banTracker == nil {
+			err = errors.New("automatic banning is not enabled")
+			break
+		}
+		if _, ok := parseClientAddr(target); !ok {
+			err = fmt.Errorf("invalid IP %q", target)
+			break
+		}
+		ban := banTracker.Ban(target, "Banned from dashboard")
+		msg = fmt.Sprintf("Banned %s until %s", ban.IP, ban.Until.Local().Format("Jan 2 15:04"))
+	case "lift":
+		if banTracker == nil {
+			err = errors.New("automatic banning is not enabled")
+			break
+		}
+		if banTracker.Lift(target) {
+			msg = "Lifted ban for " + target
+		} else {
+			err = fmt.Errorf("%s is not banned", target)
+		}
+	default:
+		err = fmt.Errorf("unknown action %q", action)
+	}
+
+	if err != nil {
+		msg = "Error: " + err.Error()
+	}
+	logger.Info("Dashboard action", slog.String("action", action), slog.String("target", target), slog.String("result", msg))
+
+	// relative, so it also works when mounted under ADMIN_PATH_PREFIX
+	w.Header().Set("Location", "./?msg="+url.QueryEscape(msg))
+	w.WriteHeader(http.StatusSeeOther)
+}
+
+// sameOrigin guards the action endpoint against cross-site form posts, which
+// browsers would otherwise send with cached basic-auth credentials.
+func sameOrigin(r *http.Request) bool {
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Header.Get("Referer")
+	}
+	if source == "" {
+		return false
+	}
+	u, err := url.Parse(source)
+	return err == nil && u.Host == r.Host
+}
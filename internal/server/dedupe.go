@@ -0,0 +1,228 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDedupeWindow     = 10 * time.Minute
+	defaultDedupeMaxEntries = 10000
+	defaultDedupeSpamIPs    = 3
+)
+
+// DuplicateVerdict classifies a submission against recently seen ones.
+type DuplicateVerdict int
+
+const (
+	// DuplicateNone is a submission not seen within the window.
+	DuplicateNone DuplicateVerdict = iota
+	// DuplicateSuppressed is a repeat that should be dropped silently.
+	DuplicateSuppressed
+	// DuplicateSpam is a message seen from too many different IPs.
+	DuplicateSpam
+)
+
+type dedupeEntry struct {
+	firstSeen time.Time
+	count     int
+	ips       map[string]struct{}
+	settled   chan struct{} // closed once the first submission is delivered or forgotten
+	delivered bool
+}
+
+// dedupeSlot is a fingerprint in the expiry order. A slot whose firstSeen
+// differs from its entry's was left behind by Forget and is skipped.
+type dedupeSlot struct {
+	fingerprint string
+	firstSeen   time.Time
+}
+
+// DuplicateDetector remembers content fingerprints of recent submissions in
+// a window bounded by time and entry count.
+type DuplicateDetector struct {
+	mu         sync.Mutex
+	window     time.Duration
+	maxEntries int
+	spamIPs    int
+	entries    map[string]*dedupeEntry
+	order      []dedupeSlot // fingerprints in first-seen order, for expiry
+	now        func() time.Time
+
+	suppressed int64
+	spam       int64
+}
+
+// NewDuplicateDetector returns a detector configured from the DEDUPE_*
+// environment variables, or nil when DEDUPE_ENABLED is not "true".
+func NewDuplicateDetector() (*DuplicateDetector, error) {
+	if os.Getenv("DEDUPE_ENABLED") != "true" {
+		return nil, nil
+	}
+
+	dd := &DuplicateDetector{
+		window:     defaultDedupeWindow,
+		maxEntries: defaultDedupeMaxEntries,
+		spamIPs:    defaultDedupeSpamIPs,
+		entries:    make(map[string]*dedupeEntry),
+		now:        time.Now,
+	}
+
+	if env := os.Getenv("DEDUPE_WINDOW"); env != "" {
+		d, err := time.ParseDuration(env)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid DEDUPE_WINDOW %q", env)
+		}
+		dd.window = d
+	}
+	if env := os.Getenv("DEDUPE_MAX_ENTRIES"); env != "" {
+		n, err := strconv.Atoi(env)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid DEDUPE_MAX_ENTRIES %q", env)
+		}
+		dd.maxEntries = n
+	}
+	if env := os.Getenv("DEDUPE_SPAM_IPS"); env != "" {
+		n, err := strconv.Atoi(env)
+		if err != nil || n < 2 {
+			return nil, fmt.Errorf("invalid DEDUPE_SPAM_IPS %q (must be at least 2)", env)
+		}
+		dd.spamIPs = n
+	}
+
+	return dd, nil
+}
+
+// DuplicateResult describes the outcome of Check.
+type DuplicateResult struct {
+	Verdict     DuplicateVerdict
+	Fingerprint string
+	Count       int // submissions with this fingerprint in the window
+	DistinctIPs int
+	Suppressed  int64 // totals since start
+	Spam        int64
+
+	entry *dedupeEntry
+}
+
+// Check records the submission and classifies it. The delivery of a new
+// submission must be reported with Delivered or, if it failed, Forget, so
+// that duplicates waiting in WaitDelivery learn the outcome and a retry goes
+// through.
+func (dd *DuplicateDetector) Check(email, subject, message, clientIP string) DuplicateResult {
+	fp := submissionFingerprint(email, subject, message)
+	now := dd.now()
+
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+
+	dd.expireLocked(now)
+
+	entry, seen := dd.entries[fp]
+	if !seen {
+		entry = &dedupeEntry{firstSeen: now, ips: make(map[string]struct{}), settled: make(chan struct{})}
+		dd.entries[fp] = entry
+		dd.order = append(dd.order, dedupeSlot{fingerprint: fp, firstSeen: now})
+	}
+	entry.count++
+	entry.ips[banKey(clientIP)] = struct{}{}
+
+	result := DuplicateResult{
+		Fingerprint: fp,
+		Count:       entry.count,
+		DistinctIPs: len(entry.ips),
+		entry:       entry,
+	}
+	switch {
+	case !seen:
+		result.Verdict = DuplicateNone
+	case len(entry.ips) >= dd.spamIPs:
+		dd.spam++
+		result.Verdict = DuplicateSpam
+	default:
+		dd.suppressed++
+		result.Verdict = DuplicateSuppressed
+	}
+	result.Suppressed = dd.suppressed
+	result.Spam = dd.spam
+	return result
+}
+
+// Delivered records that the new submission of r was delivered.
+func (dd *DuplicateDetector) Delivered(r DuplicateResult) {
+	dd.settle(r, true)
+}
+
+// Forget removes the fingerprint of r after its delivery failed, so a retry
+// is delivered.
+func (dd *DuplicateDetector) Forget(r DuplicateResult) {
+	dd.settle(r, false)
+}
+
+func (dd *DuplicateDetector) settle(r DuplicateResult, delivered bool) {
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+
+	select {
+	case <-r.entry.settled:
+		return
+	default:
+	}
+	r.entry.delivered = delivered
+	close(r.entry.settled)
+	if !delivered && dd.entries[r.Fingerprint] == r.entry {
+		delete(dd.entries, r.Fingerprint)
+	}
+}
+
+// WaitDelivery waits until the first submission of the duplicate r is
+// delivered or has failed, and reports whether it was delivered. A visitor
+// who clicks twice thus sees the outcome of the submission that was sent.
+func (dd *DuplicateDetector) WaitDelivery(ctx context.Context, r DuplicateResult) (bool, error) {
+	select {
+	case <-r.entry.settled:
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+	return r.entry.delivered, nil
+}
+
+// expireLocked drops entries older than the window and, if the detector is
+// still over capacity, the oldest remaining ones.
+func (dd *DuplicateDetector) expireLocked(now time.Time) {
+	cutoff := now.Add(-dd.window)
+	i := 0
+	for ; i < len(dd.order); i++ {
+		slot := dd.order[i]
+		entry, ok := dd.entries[slot.fingerprint]
+		if !ok || !entry.firstSeen.Equal(slot.firstSeen) {
+			continue // forgotten, and maybe seen again since
+		}
+		if entry.firstSeen.After(cutoff) && len(dd.entries) < dd.maxEntries {
+			break
+		}
+		delete(dd.entries, slot.fingerprint)
+	}
+	dd.order = dd.order[i:]
+}
+
+// submissionFingerprint hashes the normalised email, subject and message so
+// that case and whitespace differences do not defeat duplicate detection.
+func submissionFingerprint(email, subject, message string) string {
+	h := sha256.New()
+	for _, field := range []string{email, subject, message} {
+		h.Write([]byte(strings.ToLower(strings.Join(strings.Fields(field), " "))))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
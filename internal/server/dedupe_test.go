@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// newTestDetector returns a detector whose clock only moves with the
+// returned function.
+func newTestDetector(window time.Duration) (*DuplicateDetector, func(time.Duration)) {
+	now := time.Date(2026, 3, 9, 12, 0, 0, 0, time.UTC)
+	dd := &DuplicateDetector{
+		window:     window,
+		maxEntries: defaultDedupeMaxEntries,
+		spamIPs:    defaultDedupeSpamIPs,
+		entries:    make(map[string]*dedupeEntry),
+		now:        func() time.Time { return now },
+	}
+	return dd, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestDuplicateDetectorForget(t *testing.T) {
+	dd, advance := newTestDetector(100 * time.Second)
+	check := func(message string) DuplicateResult {
+		return dd.Check("ann@example.com", "Hello", message, "192.0.2.1")
+	}
+
+	dd.Delivered(check("first"))
+	dd.Forget(check("failed"))
+	advance(40 * time.Second)
+	dd.Delivered(check("second"))
+	advance(40 * time.Second)
+	retry := check("failed")
+	if retry.Verdict != DuplicateNone {
+		t.Fatalf("retry after Forget: verdict %v, want none", retry.Verdict)
+	}
+	dd.Delivered(retry)
+
+	// "first" and "second" are past the window; the slot Forget left behind
+	// must not keep them with the later time of the retry
+	advance(70 * time.Second)
+	if v := check("second").Verdict; v != DuplicateNone {
+		t.Errorf("expired submission: verdict %v, want none", v)
+	}
+	if v := check("failed").Verdict; v != DuplicateSuppressed {
+		t.Errorf("submission within the window: verdict %v, want suppressed", v)
+	}
+}
+
+func TestDuplicateDetectorWaitDelivery(t *testing.T) {
+	for _, delivered := range []bool{true, false} {
+		dd, _ := newTestDetector(time.Minute)
+		first := dd.Check("ann@example.com", "Hello", "Hi", "192.0.2.1")
+		dup := dd.Check("ann@example.com", "Hello", "Hi", "192.0.2.1")
+		if dup.Verdict != DuplicateSuppressed {
+			t.Fatalf("verdict %v, want suppressed", dup.Verdict)
+		}
+
+		// the duplicate waits for the first submission
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		if _, err := dd.WaitDelivery(ctx, dup); err == nil {
+			t.Error("WaitDelivery returned while the first submission was pending")
+		}
+		cancel()
+
+		if delivered {
+			dd.Delivered(first)
+		} else {
+			dd.Forget(first)
+		}
+		got, err := dd.WaitDelivery(context.Background(), dup)
+		if err != nil || got != delivered {
+			t.Errorf("WaitDelivery = %v, %v, want %v", got, err, delivered)
+		}
+	}
+}
@@ -0,0 +1,448 @@
+package server
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/mail"
+)
+
+// Version is set by the main package from its build-time version. Left at
+// "dev", the VCS revision recorded by the Go toolchain is reported instead.
+var Version = "dev"
+
+var startTime = time.Now()
+
+const (
+	defaultReadyChecks       = "smtp,logdir,queue,cert"
+	defaultReadyTimeout      = 5 * time.Second
+	defaultReadyCacheTTL     = 30 * time.Second
+	defaultReadyMaxQueue     = 20
+	defaultReadyCertValidity = 7 * 24 * time.Hour
+
+	CheckOK      = "ok"
+	CheckFailed  = "fail"
+	CheckSkipped = "skipped"
+)
+
+// errCheckSkipped is returned by checks that do not apply to the current
+// configuration, e.g. the certificate check in HTTP mode.
+var errCheckSkipped = errors.New("not applicable")
+
+// CheckResult is the outcome of one readiness check.
+type CheckResult struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// ReadinessReport is the body of /readyz.
+type ReadinessReport struct {
+	Status    string        `json:"status"`
+	CheckedAt time.Time     `json:"checked_at"`
+	Checks    []CheckResult `json:"checks"`
+}
+
+// Ready reports whether no check failed; skipped checks do not count.
+func (r ReadinessReport) Ready() bool {
+	return r.Status == "ready"
+}
+
+// Public returns the report without details and errors, which name hosts,
+// ports and paths. Failures are logged, and the full report is available
+// from the admin API.
+func (r ReadinessReport) Public() ReadinessReport {
+	checks := make([]CheckResult, len(r.Checks))
+	for i, check := range r.Checks {
+		checks[i] = CheckResult{Name: check.Name, Status: check.Status, Duration: check.Duration}
+	}
+	r.Checks = checks
+	return r
+}
+
+// StatusReport is the body of /status.
+type StatusReport struct {
+	Service   string        `json:"service"`
+	Version   string        `json:"version"`
+	GoVersion string        `json:"go_version"`
+	StartedAt time.Time     `json:"started_at"`
+	Uptime    string        `json:"uptime"`
+	Ready     bool          `json:"ready"`
+	CheckedAt time.Time     `json:"checked_at"`
+	Checks    []CheckResult `json:"checks"`
+}
+
+type healthCheck struct {
+	name string
+	run  func(ctx context.Context) (string, error)
+}
+
+// HealthChecker runs the readiness checks. Results are cached so that
+// frequent probes do not open an SMTP session every time.
+type HealthChecker struct {
+	mu              sync.Mutex
+	checks          []healthCheck
+	timeout         time.Duration
+	cacheTTL        time.Duration
+	maxQueue        int64
+	minCertValidity time.Duration
+	last            ReadinessReport
+}
+
+// NewHealthChecker returns a checker configured from the READY_* environment
+// variables.
+func NewHealthChecker() (*HealthChecker, error) {
+	hc := &HealthChecker{
+		timeout:         defaultReadyTimeout,
+		cacheTTL:        defaultReadyCacheTTL,
+		maxQueue:        defaultReadyMaxQueue,
+		minCertValidity: defaultReadyCertValidity,
+	}
+
+	for _, setting := range []struct {
+		env string
+		dst *time.Duration
+		min time.Duration
+	}{
+		{"READY_CHECK_TIMEOUT", &hc.timeout, time.Millisecond},
+		{"READY_CACHE_TTL", &hc.cacheTTL, 0},
+		{"READY_CERT_MIN_VALIDITY", &hc.minCertValidity, 0},
+	} {
+		if env := os.Getenv(setting.env); env != "" {
+			d, err := time.ParseDuration(env)
+			if err != nil || d < setting.min {
+				return nil, fmt.Errorf("invalid %s %q", setting.env, env)
+			}
+			*setting.dst = d
+		}
+	}
+	if env := os.Getenv("READY_MAX_QUEUE"); env != "" {
+		n, err := strconv.ParseInt(env, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid READY_MAX_QUEUE %q", env)
+		}
+		hc.maxQueue = n
+	}
+
+	names := os.Getenv("READY_CHECKS")
+	if names == "" {
+		names = defaultReadyChecks
+	}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		var run func(ctx context.Context) (string, error)
+		switch name {
+		case "":
+			continue
+		case "none":
+			hc.checks = nil
+			continue
+		case "smtp":
+			run = checkSMTP
+		case "logdir":
+			run = checkLogDirs
+		case "queue":
+			run = hc.checkQueue
+		case "cert":
+			run = hc.checkCertificate
+		default:
+			return nil, fmt.Errorf("unknown readiness check %q in READY_CHECKS", name)
+		}
+		hc.checks = append(hc.checks, healthCheck{name: name, run: run})
+	}
+
+	return hc, nil
+}
+
+// Check runs all checks concurrently, or returns the cached report if it is
+// younger than READY_CACHE_TTL.
+func (hc *HealthChecker) Check(ctx context.Context) ReadinessReport {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	now := time.Now()
+	if !hc.last.CheckedAt.IsZero() && now.Sub(hc.last.CheckedAt) < hc.cacheTTL {
+		return hc.last
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, hc.timeout)
+	defer cancel()
+
+	results := make([]CheckResult, len(hc.checks))
+	var wg sync.WaitGroup
+	for i, check := range hc.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			detail, err := check.run(checkCtx)
+			result := CheckResult{
+				Name:     check.name,
+				Status:   CheckOK,
+				Detail:   detail,
+				Duration: time.Since(start).Round(time.Millisecond).String(),
+			}
+			switch {
+			case errors.Is(err, errCheckSkipped):
+				result.Status = CheckSkipped
+			case err != nil:
+				result.Status = CheckFailed
+				result.Error = err.Error()
+			}
+			results[i] = result
+		}()
+	}
+	wg.Wait()
+
+	report := ReadinessReport{Status: "ready", CheckedAt: now, Checks: results}
+	for _, result := range results {
+		if result.Status == CheckFailed {
+			report.Status = "not_ready"
+			logger.Warn("Readiness check failed", slog.String("check", result.Name), slog.String("error", result.Error))
+		}
+	}
+
+	// a probe that hung up early must not poison the cache for the next one
+	if ctx.Err() == nil {
+		hc.last = report
+	}
+	return report
+}
+
+// checkSMTP performs the same handshake as sendEmail, up to and including
+// authentication, without sending a message.
+func checkSMTP(ctx context.Context) (string, error) {
+	cfg := mail.ConfigFromEnv()
+	if cfg.Host == "" || cfg.Port == "" || cfg.Username == "" || cfg.Password == "" {
+		return "", mail.ErrNotConfigured
+	}
+
+	client, err := mail.Dial(ctx, cfg)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	detail := cfg.Addr()
+	if _, ok := client.TLSConnectionState(); ok {
+		detail += " (STARTTLS)"
+	}
+	_ = client.Quit()
+
+	return detail + ", authenticated", nil
+}
+
+// checkLogDirs verifies that every directory the enabled features write to
+// can be written.
+func checkLogDirs(ctx context.Context) (string, error) {
+	var dirs []string
+	if spamLogger != nil {
+		dirs = append(dirs, spamLogger.Dir())
+	}
+	if quarantineStore != nil {
+		dirs = append(dirs, quarantineStore.dir)
+	}
+	if submissionArchive != nil {
+		dirs = append(dirs, filepath.Dir(submissionArchive.Path()))
+	}
+	if banTracker != nil && banTracker.stateFile != "" {
+		dirs = append(dirs, filepath.Dir(banTracker.stateFile))
+	}
+	if len(dirs) == 0 {
+		return "no directories configured", errCheckSkipped
+	}
+
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", err
+		}
+		f, err := os.CreateTemp(dir, ".readyz-*")
+		if err != nil {
+			return "", fmt.Errorf("%s is not writable: %w", dir, err)
+		}
+		f.Close()
+		os.Remove(f.Name())
+	}
+	return strings.Join(dirs, ", "), nil
+}
+
+// checkQueue fails when too many deliveries are waiting on SMTP at once,
+// which means the mail server is stalling.
+func (hc *HealthChecker) checkQueue(ctx context.Context) (string, error) {
+	depth := deliveriesInFlight.Load()
+	detail := fmt.Sprintf("%d in flight, limit %d", depth, hc.maxQueue)
+	if depth >= hc.maxQueue {
+		return detail, fmt.Errorf("%d deliveries in flight", depth)
+	}
+	return detail, nil
+}
+
+// checkCertificate fails when a serving certificate expires within
+// READY_CERT_MIN_VALIDITY.
+func (hc *HealthChecker) checkCertificate(ctx context.Context) (string, error) {
+	var cert *x509.Certificate
+	switch {
+	case servingACME != nil:
+		data, err := servingACME.certificatePEM(ctx)
+		if err != nil {
+			return "", err
+		}
+		// the ACME cache holds the private key first, then the chain
+		var block *pem.Block
+		for {
+			block, data = pem.Decode(data)
+			if block == nil || block.Type == "CERTIFICATE" {
+				break
+			}
+		}
+		if block == nil {
+			return "", errors.New("no certificate found in the ACME cache")
+		}
+		if cert, err = x509.ParseCertificate(block.Bytes); err != nil {
+			return "", err
+		}
+	case servingCerts != nil:
+		// the one that expires first
+		for _, leaf := range servingCerts.Leaves() {
+			if cert == nil || leaf.NotAfter.Before(cert.NotAfter) {
+				cert = leaf
+			}
+		}
+	default:
+		return "HTTPS disabled", errCheckSkipped
+	}
+
+	remaining := time.Until(cert.NotAfter)
+	detail := fmt.Sprintf("%s expires %s", cert.Subject.CommonName, cert.NotAfter.UTC().Format(time.RFC3339))
+	if remaining < hc.minCertValidity {
+		return detail, fmt.Errorf("certificate expires in %s", remaining.Round(time.Minute))
+	}
+	return detail, nil
+}
+
+// livezHandler reports that the process is up and serving requests. It
+// deliberately checks nothing else, so a failing dependency does not get the
+// container restarted.
+func livezHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write([]byte(`{"status":"alive"}`))
+}
+
+// ReadyzHandler returns 200 when all enabled checks pass and 503 otherwise.
+func (hc *HealthChecker) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	report := hc.Check(r.Context()).Public()
+
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+// StatusHandler serves the status page as HTML, or as JSON when requested
+// with ?format=json or an Accept: application/json header.
+func (hc *HealthChecker) StatusHandler(w http.ResponseWriter, r *http.Request) {
+	report := hc.Check(r.Context()).Public()
+	status := StatusReport{
+		Service:   "hugo-contact",
+		Version:   buildVersion(),
+		GoVersion: runtime.Version(),
+		StartedAt: startTime,
+		Uptime:    time.Since(startTime).Round(time.Second).String(),
+		Ready:     report.Ready(),
+		CheckedAt: report.CheckedAt,
+		Checks:    report.Checks,
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := statusTemplate.Execute(w, status); err != nil {
+		logger.Error("Failed to render status page", slog.String("error", err.Error()))
+	}
+}
+
+// buildVersion returns the linked-in version, falling back to the VCS
+// revision when built from a checkout.
+func buildVersion() string {
+	if Version != "dev" {
+		return Version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return Version
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" && len(setting.Value) >= 12 {
+			return Version + "-" + setting.Value[:12]
+		}
+	}
+	return Version
+}
+
+var statusTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <title>Contact Form Status</title>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <style>
+        body { font-family: system-ui, -apple-system, sans-serif; max-width: 600px; margin: 50px auto; padding: 20px; background: #f5f5f5; }
+        .status-card { background: white; padding: 30px; border-radius: 10px; box-shadow: 0 2px 10px rgba(0,0,0,0.1); }
+        h1 { color: #333; margin-bottom: 30px; }
+        .status-item { margin: 20px 0; padding: 15px; border-radius: 5px; display: flex; justify-content: space-between; align-items: center; gap: 15px; }
+        .ok { background: #d4edda; color: #155724; }
+        .fail { background: #f8d7da; color: #721c24; }
+        .skipped { background: #e2e3e5; color: #383d41; }
+        .detail { font-size: 0.85em; opacity: 0.8; }
+        .info { margin-top: 30px; font-size: 0.9em; color: #666; }
+    </style>
+</head>
+<body>
+    <div class="status-card">
+        <h1>{{if .Ready}}✅ Service Operational{{else}}❌ Service Degraded{{end}}</h1>
+        {{range .Checks}}
+        <div class="status-item {{.Status}}">
+            <div><strong>{{.Name}}</strong><br><span class="detail">{{if .Error}}{{.Error}}{{else}}{{.Detail}}{{end}}</span></div>
+            <span>{{.Status}} · {{.Duration}}</span>
+        </div>
+        {{else}}
+        <div class="status-item skipped"><strong>No readiness checks configured</strong></div>
+        {{end}}
+        <div class="info">
+            Version {{.Version}} ({{.GoVersion}})<br>
+            Up {{.Uptime}} since {{.StartedAt.UTC.Format "2006-01-02 15:04:05 MST"}}<br>
+            Checked {{.CheckedAt.UTC.Format "2006-01-02 15:04:05 MST"}}
+        </div>
+    </div>
+</body>
+</html>
+`))
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const defaultIPListReloadInterval = 30 * time.Second
+
+type ipRule struct {
+	prefix netip.Prefix
+	entry  string
+}
+
+// IPFilter enforces allow and deny lists of IPs and CIDRs loaded from files.
+// Allow entries take precedence, so a single address can be exempted from a
+// denied range. The lists are reloaded when the files change or on SIGHUP.
+type IPFilter struct {
+	mu        sync.RWMutex
+	denyFile  string
+	allowFile string
+	deny      []ipRule
+	allow     []ipRule
+	modTimes  map[string]time.Time
+}
+
+// NewIPFilter loads the files named by IP_DENYLIST_FILE and IP_ALLOWLIST_FILE.
+// It returns nil without error when neither is configured.
+func NewIPFilter() (*IPFilter, error) {
+	f := &IPFilter{
+		denyFile:  os.Getenv("IP_DENYLIST_FILE"),
+		allowFile: os.Getenv("IP_ALLOWLIST_FILE"),
+		modTimes:  make(map[string]time.Time),
+	}
+	if f.denyFile == "" && f.allowFile == "" {
+		return nil, nil
+	}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Check reports whether the client IP is denied, together with the list
+// entry that matched.
+func (f *IPFilter) Check(clientIP string) (bool, string) {
+	addr, ok := parseClientAddr(clientIP)
+	if !ok {
+		return false, ""
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for _, rule := range f.allow {
+		if rule.prefix.Contains(addr) {
+			return false, rule.entry
+		}
+	}
+	for _, rule := range f.deny {
+		if rule.prefix.Contains(addr) {
+			return true, rule.entry
+		}
+	}
+	return false, ""
+}
+
+// Reload re-reads both list files and swaps them in atomically. On error the
+// previous lists stay in effect until the files change again.
+func (f *IPFilter) Reload() error {
+	f.mu.Lock()
+	for _, file := range []string{f.denyFile, f.allowFile} {
+		if file == "" {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil {
+			f.modTimes[file] = info.ModTime()
+		}
+	}
+	f.mu.Unlock()
+
+	deny, err := loadIPList(f.denyFile)
+	if err != nil {
+		return err
+	}
+	allow, err := loadIPList(f.allowFile)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	f.deny = deny
+	f.allow = allow
+	f.mu.Unlock()
+
+	logger.Info("IP lists loaded", slog.Int("deny", len(deny)), slog.Int("allow", len(allow)))
+	return nil
+}
+
+// Watch reloads the lists on SIGHUP and whenever one of the files changes.
+// The interval is taken from IP_LIST_RELOAD_INTERVAL.
+func (f *IPFilter) Watch() {
+	interval := defaultIPListReloadInterval
+	if env := os.Getenv("IP_LIST_RELOAD_INTERVAL"); env != "" {
+		if d, err := time.ParseDuration(env); err == nil && d > 0 {
+			interval = d
+		}
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		for {
+			select {
+			case <-hup:
+				logger.Info("SIGHUP received, reloading IP lists")
+			case <-ticker.C:
+				if !f.changed() {
+					continue
+				}
+			}
+			if err := f.Reload(); err != nil {
+				logger.Error("Failed to reload IP lists", slog.String("error", err.Error()))
+			}
+		}
+	}()
+}
+
+func (f *IPFilter) changed() bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for _, file := range []string{f.denyFile, f.allowFile} {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		if !info.ModTime().Equal(f.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadIPList parses one IP or CIDR per line. Blank lines and text after '#'
+// are ignored.
+func loadIPList(filename string) ([]ipRule, error) {
+	if filename == "" {
+		return nil, nil
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open IP list: %w", err)
+	}
+	defer file.Close()
+
+	var rules []ipRule
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		prefix, err := parseIPOrCIDR(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", filename, lineNo, err)
+		}
+		rules = append(rules, ipRule{prefix: prefix, entry: line})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read IP list: %w", err)
+	}
+
+	return rules, nil
+}
+
+func parseIPOrCIDR(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid CIDR %q", s)
+		}
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid IP %q", s)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// parseClientAddr parses a client address as returned by getClientIP or
+// given by an operator. A port, as found in older spam log entries, is ignored.
+func parseClientAddr(clientIP string) (netip.Addr, bool) {
+	host := strings.TrimSpace(clientIP)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Submission outcomes used as the "outcome" label.
+const (
+	OutcomeDelivered       = "delivered"
+	OutcomeSpam            = "spam"
+	OutcomeDuplicate       = "duplicate"
+	OutcomeValidationError = "validation_error"
+	OutcomeMailError       = "mail_error"
+	OutcomeForbidden       = "forbidden"
+)
+
+// maxOriginLabels caps the distinct origins tracked for token requests, as
+// the Origin and Referer headers are chosen by the client.
+const maxOriginLabels = 50
+
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	submissionsTotal = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "hugo_contact",
+		Name:      "submissions_total",
+		Help:      "Form submissions by form ID, outcome and, for spam, reason.",
+	}, []string{"form", "outcome", "reason"})
+
+	tokensIssuedTotal = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: "hugo_contact",
+		Name:      "tokens_issued_total",
+		Help:      "Anti-spam tokens issued by requesting origin.",
+	}, []string{"origin"})
+
+	requestDuration = promauto.With(metricsRegistry).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "hugo_contact",
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of public HTTP requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"handler", "method", "code"})
+
+	smtpSendDuration = promauto.With(metricsRegistry).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "hugo_contact",
+		Name:      "smtp_send_duration_seconds",
+		Help:      "Time spent delivering one message over SMTP.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 30},
+	}, []string{"result"})
+
+	_ = promauto.With(metricsRegistry).NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "hugo_contact",
+		Name:      "queue_depth",
+		Help:      "Deliveries currently waiting on the SMTP server.",
+	}, func() float64 { return float64(deliveriesInFlight.Load()) })
+
+	_ = promauto.With(metricsRegistry).NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "hugo_contact",
+		Name:      "spam_log_size_bytes",
+		Help:      "Disk space used by spam log files.",
+	}, func() float64 {
+		if spamLogger == nil {
+			return 0
+		}
+		size, _ := spamLogger.DiskUsage()
+		return float64(size)
+	})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// observeSubmission counts a finished submission. The reason is only kept
+// for spam, reduced to a fixed set of values.
+func observeSubmission(r *http.Request, outcome, reason string) {
+	if outcome == OutcomeSpam {
+		reason = spamReasonLabel(reason)
+	} else {
+		reason = ""
+	}
+	submissionsTotal.WithLabelValues(getFormID(r), outcome, reason).Inc()
+}
+
+// spamReasonLabel maps a spam log reason, which may carry details such as
+// the matching deny list entry, to a label value.
+func spamReasonLabel(reason string) string {
+	for _, prefix := range []struct {
+		text  string
+		label string
+	}{
+		{"Denied IP", "denied_ip"},
+		{"Banned IP", "banned_ip"},
+		{"Invalid token", "invalid_token"},
+		{"Honeypot", "honeypot"},
+		{"CAPTCHA missing", "captcha_missing"},
+		{"CAPTCHA failed", "captcha_failed"},
+		{"CAPTCHA unavailable", "captcha_unavailable"},
+		{"Duplicate message", "duplicate_message"},
+	} {
+		if strings.HasPrefix(reason, prefix.text) {
+			return prefix.label
+		}
+	}
+	return "other"
+}
+
+var tokenOrigins = struct {
+	sync.Mutex
+	seen map[string]struct{}
+}{seen: make(map[string]struct{})}
+
+// observeTokenIssued counts a token by the page's origin, taken from the
+// Origin header or, for plain script tags, the Referer.
+func observeTokenIssued(r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		if u, err := url.Parse(r.Referer()); err == nil && u.Host != "" {
+			origin = u.Scheme + "://" + u.Host
+		}
+	}
+	if origin == "" {
+		origin = "none"
+	}
+
+	tokenOrigins.Lock()
+	if _, ok := tokenOrigins.seen[origin]; !ok {
+		if len(tokenOrigins.seen) >= maxOriginLabels {
+			origin = "other"
+		} else {
+			tokenOrigins.seen[origin] = struct{}{}
+		}
+	}
+	tokenOrigins.Unlock()
+
+	tokensIssuedTotal.WithLabelValues(origin).Inc()
+}
+
+// observeSMTPSend records the duration of one delivery attempt.
+func observeSMTPSend(start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	smtpSendDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+}
+
+// instrumentHandler records request latency for a public handler.
+func instrumentHandler(name string, handler http.Handler) http.Handler {
+	return promhttp.InstrumentHandlerDuration(
+		requestDuration.MustCurryWith(prometheus.Labels{"handler": name}),
+		handler,
+	)
+}
+
+// startMetrics serves /metrics on METRICS_LISTEN_ADDR, or on the public port
+// when only METRICS_ENABLED is set.
+func startMetrics() {
+	addr := os.Getenv("METRICS_LISTEN_ADDR")
+	if addr == "" && os.Getenv("METRICS_ENABLED") != "true" {
+		return
+	}
+
+	handler := promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{
+		ErrorLog: slog.NewLogLogger(logger.Handler(), slog.LevelError),
+	})
+
+	if addr == "" {
+		http.Handle("/metrics", handler)
+		logger.Info("Metrics enabled", slog.String("path", "/metrics"))
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", handler)
+	server := &http.Server{
+		Addr:    addr,
+		Handler: mux,
+		ErrorLog: slog.NewLogLogger(
+			slog.NewJSONHandler(os.Stdout, nil),
+			slog.LevelError,
+		),
+	}
+	trackServer(server)
+	go func() {
+		logger.Info("Starting metrics listener", slog.String("addr", addr))
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Metrics server failed", slog.String("error", err.Error()))
+		}
+	}()
+}
@@ -0,0 +1,409 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	defaultQuarantineDir       = "/var/log/hugo-contact/quarantine"
+	defaultQuarantineThreshold = 75
+	defaultQuarantineRetention = 30
+
+	// quarantineSendTimeout bounds the delivery of a released item, and a
+	// claim older than quarantineClaimTimeout was left by a crashed process
+	quarantineSendTimeout  = 30 * time.Second
+	quarantineClaimTimeout = 10 * time.Minute
+
+	QuarantinePending   = "pending"
+	QuarantineReleasing = "releasing" // being delivered, or interrupted
+	QuarantineReleased  = "released"
+	QuarantineSpam      = "spam"
+)
+
+var quarantineIDPattern = regexp.MustCompile(`^[0-9]{8}-[0-9]{6}-[0-9a-f]{8}$`)
+
+// ErrQuarantineNotFound is returned for unknown or malformed item IDs.
+var ErrQuarantineNotFound = errors.New("quarantined item not found")
+
+// ErrQuarantineBusy is returned while another request or process reviews the
+// item.
+var ErrQuarantineBusy = errors.New("quarantined item is being reviewed")
+
+// QuarantineItem is a rejected submission kept in full, unlike the
+// sanitised and truncated spam log entry, so it can be reviewed and released.
+type QuarantineItem struct {
+	ID         string              `json:"id"`
+	ReceivedAt time.Time           `json:"received_at"`
+	FormID     string              `json:"form_id"`
+	ClientIP   string              `json:"client_ip"`
+	Reason     string              `json:"reason"`
+	Score      int                 `json:"score"`
+	Name       string              `json:"name"`
+	Email      string              `json:"email"`
+	Subject    string              `json:"subject"`
+	Message    string              `json:"message"`
+	Fields     map[string][]string `json:"fields"`
+	Status     string              `json:"status"`
+	ReviewedAt time.Time           `json:"reviewed_at,omitzero"`
+}
+
+// QuarantineStore keeps one JSON file per item in a directory.
+type QuarantineStore struct {
+	mu            sync.Mutex
+	dir           string
+	threshold     int
+	retentionDays int
+}
+
+// NewQuarantineStore returns a store configured from QUARANTINE_DIR,
+// QUARANTINE_THRESHOLD and QUARANTINE_RETENTION_DAYS.
+func NewQuarantineStore() *QuarantineStore {
+	dir := os.Getenv("QUARANTINE_DIR")
+	if dir == "" {
+		dir = defaultQuarantineDir
+	}
+
+	threshold := defaultQuarantineThreshold
+	if env := os.Getenv("QUARANTINE_THRESHOLD"); env != "" {
+		if n, err := strconv.Atoi(env); err == nil && n > 0 && n <= 100 {
+			threshold = n
+		}
+	}
+
+	retentionDays := defaultQuarantineRetention
+	if env := os.Getenv("QUARANTINE_RETENTION_DAYS"); env != "" {
+		if n, err := strconv.Atoi(env); err == nil && n > 0 {
+			retentionDays = n
+		}
+	}
+
+	return &QuarantineStore{
+		dir:           dir,
+		threshold:     threshold,
+		retentionDays: retentionDays,
+	}
+}
+
+// Borderline reports whether a spam verdict with the given score (0-100, the
+// confidence that the submission is spam) should be quarantined.
+func (q *QuarantineStore) Borderline(score int) bool {
+	return score < q.threshold
+}
+
+// Add stores the item as pending and returns its ID.
+func (q *QuarantineStore) Add(item QuarantineItem) (string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := os.MkdirAll(q.dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	item.ID = item.ReceivedAt.UTC().Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+	item.Status = QuarantinePending
+
+	if err := q.writeLocked(item); err != nil {
+		return "", err
+	}
+
+	return item.ID, nil
+}
+
+// Get returns a single item.
+func (q *QuarantineStore) Get(id string) (QuarantineItem, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.readLocked(id)
+}
+
+// List returns items with the given status (all items if status is empty),
+// newest first.
+func (q *QuarantineStore) List(status string) ([]QuarantineItem, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(q.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var items []QuarantineItem
+	for _, file := range files {
+		id := filepath.Base(file[:len(file)-len(".json")])
+		item, err := q.readLocked(id)
+		if err != nil {
+			continue // Skip unreadable items
+		}
+		if status == "" || item.Status == status {
+			items = append(items, item)
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].ReceivedAt.After(items[j].ReceivedAt)
+	})
+	return items, nil
+}
+
+// Release delivers a pending item through the normal mail path and marks it
+// as released. The item is claimed first, so the server and the quarantine
+// command cannot both deliver it, and the lock is not held while sending.
+func (q *QuarantineStore) Release(id string) (QuarantineItem, error) {
+	item, release, err := q.claim(id)
+	if err != nil {
+		return item, err
+	}
+	defer release()
+
+	item.Status = QuarantineReleasing
+	if err := q.write(item); err != nil {
+		return item, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), quarantineSendTimeout)
+	defer cancel()
+	if err := sendEmail(ctx, item.Name, item.Email, item.Message, item.Subject); err != nil {
+		item.Status = QuarantinePending
+		if writeErr := q.write(item); writeErr != nil {
+			return item, writeErr
+		}
+		return item, fmt.Errorf("failed to deliver released item: %w", err)
+	}
+
+	item.Status = QuarantineReleased
+	item.ReviewedAt = time.Now()
+	return item, q.write(item)
+}
+
+// MarkSpam confirms a pending item as spam. It is kept until retention
+// cleanup so the decision can be audited.
+func (q *QuarantineStore) MarkSpam(id string) (QuarantineItem, error) {
+	item, release, err := q.claim(id)
+	if err != nil {
+		return item, err
+	}
+	defer release()
+
+	item.Status = QuarantineSpam
+	item.ReviewedAt = time.Now()
+	return item, q.write(item)
+}
+
+// claim reserves a pending item for review by creating its claim file, which
+// fails while another request or process holds it, and returns the item and
+// a function that gives it back. An item left releasing by a crash can be
+// claimed again once its claim is stale.
+func (q *QuarantineStore) claim(id string) (QuarantineItem, func(), error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !quarantineIDPattern.MatchString(id) {
+		return QuarantineItem{}, nil, ErrQuarantineNotFound
+	}
+	path := filepath.Join(q.dir, id+".claim")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if errors.Is(err, os.ErrExist) {
+		if info, statErr := os.Stat(path); statErr == nil && time.Since(info.ModTime()) > quarantineClaimTimeout {
+			os.Remove(path)
+			f, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		}
+	}
+	if errors.Is(err, os.ErrExist) {
+		return QuarantineItem{}, nil, fmt.Errorf("item %s: %w", id, ErrQuarantineBusy)
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return QuarantineItem{}, nil, ErrQuarantineNotFound // no quarantine directory yet
+	}
+	if err != nil {
+		return QuarantineItem{}, nil, fmt.Errorf("failed to claim quarantined item: %w", err)
+	}
+	f.Close()
+	release := func() { os.Remove(path) }
+
+	item, err := q.readLocked(id)
+	if err == nil && item.Status != QuarantinePending && item.Status != QuarantineReleasing {
+		err = fmt.Errorf("item %s is already %s", id, item.Status)
+	}
+	if err != nil {
+		release()
+		return item, nil, err
+	}
+	return item, release, nil
+}
+
+func (q *QuarantineStore) write(item QuarantineItem) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.writeLocked(item)
+}
+
+func (q *QuarantineStore) readLocked(id string) (QuarantineItem, error) {
+	var item QuarantineItem
+	if !quarantineIDPattern.MatchString(id) {
+		return item, ErrQuarantineNotFound
+	}
+
+	data, err := os.ReadFile(filepath.Join(q.dir, id+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return item, ErrQuarantineNotFound
+	}
+	if err != nil {
+		return item, err
+	}
+	if err := json.Unmarshal(data, &item); err != nil {
+		return item, fmt.Errorf("failed to parse quarantined item: %w", err)
+	}
+	return item, nil
+}
+
+// writeLocked replaces the item's file atomically. Files are private to the
+// service user because they hold unsanitised personal data.
+func (q *QuarantineStore) writeLocked(item QuarantineItem) error {
+	data, err := json.MarshalIndent(item, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file := filepath.Join(q.dir, item.ID+".json")
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write quarantined item: %w", err)
+	}
+	return os.Rename(tmp, file)
+}
+
+// RunRetention removes items older than the retention period now and then
+// once an hour, in the background.
+func (q *QuarantineStore) RunRetention() {
+	go func() {
+		q.cleanOld()
+		for range time.Tick(time.Hour) {
+			q.cleanOld()
+		}
+	}()
+}
+
+func (q *QuarantineStore) cleanOld() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	cutoff := time.Now().AddDate(0, 0, -q.retentionDays)
+
+	files, err := filepath.Glob(filepath.Join(q.dir, "*.json"))
+	if err != nil {
+		return
+	}
+
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+
+		if info.ModTime().Before(cutoff) {
+			os.Remove(file)
+			os.Remove(strings.TrimSuffix(file, ".json") + ".claim")
+		}
+	}
+}
+
+// RunQuarantineCommand implements "hugo-contact quarantine". Releasing an
+// item needs the same SMTP environment as the server.
+func RunQuarantineCommand(args []string) int {
+	usage := "usage: hugo-contact quarantine list [pending|released|spam] | show <id> | release <id> | spam <id>"
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	store := NewQuarantineStore()
+
+	switch args[0] {
+	case "list":
+		status := QuarantinePending
+		if len(args) > 1 {
+			status = args[1]
+			if status == "all" {
+				status = ""
+			}
+		}
+		items, err := store.List(status)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(items) == 0 {
+			fmt.Println("No quarantined items")
+			return 0
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tSTATUS\tSCORE\tEMAIL\tSUBJECT\tREASON")
+		for _, item := range items {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\n", item.ID, item.Status, item.Score,
+				item.Email, truncateForTable(item.Subject, 40), item.Reason)
+		}
+		tw.Flush()
+		return 0
+
+	case "show", "release", "spam":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, usage)
+			return 2
+		}
+
+		var item QuarantineItem
+		var err error
+		switch args[0] {
+		case "show":
+			item, err = store.Get(args[1])
+		case "release":
+			item, err = store.Release(args[1])
+		case "spam":
+			item, err = store.MarkSpam(args[1])
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		if args[0] == "show" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			_ = enc.Encode(item)
+		} else {
+			fmt.Printf("Item %s marked as %s\n", item.ID, item.Status)
+		}
+		return 0
+	}
+
+	fmt.Fprintln(os.Stderr, usage)
+	return 2
+}
+
+func truncateForTable(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestQuarantine(t *testing.T) (*QuarantineStore, string) {
+	t.Helper()
+	q := &QuarantineStore{dir: t.TempDir(), threshold: defaultQuarantineThreshold, retentionDays: defaultQuarantineRetention}
+	id, err := q.Add(QuarantineItem{ReceivedAt: time.Now(), Name: "Ann", Email: "ann@example.com", Message: "Hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q, id
+}
+
+func TestQuarantineRelease(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		rejectData bool
+		want       string
+	}{
+		{"delivered", false, QuarantineReleased},
+		{"rejected", true, QuarantinePending},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			startSMTPStub(t, tt.rejectData)
+			q, id := newTestQuarantine(t)
+
+			_, err := q.Release(id)
+			if tt.rejectData != (err != nil) {
+				t.Fatalf("Release: %v", err)
+			}
+			item, err := q.Get(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if item.Status != tt.want {
+				t.Errorf("status = %s, want %s", item.Status, tt.want)
+			}
+			if _, err := os.Stat(filepath.Join(q.dir, id+".claim")); !errors.Is(err, os.ErrNotExist) {
+				t.Error("claim file left behind")
+			}
+		})
+	}
+}
+
+func TestQuarantineClaim(t *testing.T) {
+	q, id := newTestQuarantine(t)
+
+	// another process reviewing the item
+	other := &QuarantineStore{dir: q.dir}
+	_, release, err := other.claim(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.MarkSpam(id); !errors.Is(err, ErrQuarantineBusy) {
+		t.Errorf("MarkSpam of a claimed item: %v, want ErrQuarantineBusy", err)
+	}
+	release()
+
+	if _, err := q.MarkSpam(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Release(id); err == nil {
+		t.Error("Release of an item marked as spam succeeded")
+	}
+
+	// a claim left by a crash expires
+	q, id = newTestQuarantine(t)
+	claim := filepath.Join(q.dir, id+".claim")
+	if err := os.WriteFile(claim, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	stale := time.Now().Add(-quarantineClaimTimeout - time.Minute)
+	os.Chtimes(claim, stale, stale)
+	if _, err := q.MarkSpam(id); err != nil {
+		t.Errorf("MarkSpam with a stale claim: %v", err)
+	}
+}
+
+func TestQuarantineReleaseDoesNotBlockAdd(t *testing.T) {
+	// an SMTP server that accepts the connection and never answers
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	startSMTPStub(t, false)
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	t.Setenv("SMTP_PORT", port)
+	conns := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			conns <- conn
+		}
+	}()
+
+	q, id := newTestQuarantine(t)
+	released := make(chan error, 1)
+	go func() {
+		_, err := q.Release(id)
+		released <- err
+	}()
+	conn := <-conns
+
+	added := make(chan error, 1)
+	go func() {
+		_, err := q.Add(QuarantineItem{ReceivedAt: time.Now()})
+		added <- err
+	}()
+	select {
+	case err := <-added:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Add blocked while a release was sending")
+	}
+	if item, _ := q.Get(id); item.Status != QuarantineReleasing {
+		t.Errorf("status while sending = %s, want %s", item.Status, QuarantineReleasing)
+	}
+
+	conn.Close()
+	if err := <-released; err == nil {
+		t.Error("Release succeeded without an SMTP reply")
+	}
+}
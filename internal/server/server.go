@@ -0,0 +1,930 @@
+// Package server implements the form endpoint, its spam defences and the admin
+// interfaces.
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/archive"
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/mail"
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/report"
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/spamlog"
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/token"
+)
+
+var logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+var tokenSecret []byte
+var spamLogger *spamlog.Logger
+var captchaVerifier CaptchaVerifier
+var ipFilter *IPFilter
+var banTracker *BanTracker
+var dupDetector *DuplicateDetector
+var quarantineStore *QuarantineStore
+var submissionArchive *archive.Archive
+var reportScheduler *report.Scheduler
+var digestScheduler *report.Scheduler
+var alerter *Alerter
+var deliveriesInFlight atomic.Int64
+var tracingShutdown func(context.Context) error
+var healthChecker *HealthChecker
+var serverListen listenConfig // validated by configure
+var forms map[string]bool     // form IDs served under /f/, from FORMS
+
+// sendEmail delivers one submission. The context only carries the trace;
+// a visitor who disconnects does not abort a delivery already under way.
+func sendEmail(ctx context.Context, name, email, message, subject string) error {
+	cfg := mail.ConfigFromEnv()
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	// Use custom subject if provided, otherwise use default
+	if subject == "" {
+		subject = "Contact Form Submission"
+	}
+
+	ctx, span := tracer.Start(context.WithoutCancel(ctx), "smtp.send",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.ServerAddress(cfg.Host)))
+	start := time.Now()
+
+	_, render := tracer.Start(ctx, "email.render")
+	body := fmt.Sprintf("From: %s\nTo: %s\nSubject: %s\nDate: %s\n\nName: %s\nEmail: %s\nMessage:\n%s",
+		cfg.Sender, cfg.Recipient, subject, time.Now().Format(time.RFC1123Z), name, email, message)
+	render.End()
+
+	err := mail.Send(ctx, cfg, []byte(body))
+	observeSMTPSend(start, err)
+	if err != nil {
+		countAlertEvent(alertDeliveryFailures)
+	}
+	endSpan(span, err)
+	return err
+}
+
+func contactHandler(w http.ResponseWriter, r *http.Request) {
+	ip := getClientIP(r)
+
+	if !checkAndSetCORSHeaders(w, r) {
+		logger.Warn("Blocked request due to invalid origin", slog.String("origin", r.Header.Get("Origin")), slog.String("ip", ip))
+		observeSubmission(r, OutcomeForbidden, "")
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		logger.Warn("Invalid HTTP method", slog.String("method", r.Method))
+		observeSubmission(r, OutcomeValidationError, "")
+		return
+	}
+
+	_ = r.ParseForm()
+
+	// IP deny list is enforced before any other check
+	if ipFilter != nil {
+		_, done := traceCheck(r.Context(), "ip_filter")
+		denied, entry := ipFilter.Check(ip)
+		done(denied)
+		if denied {
+			logger.Warn("Blocked request from denied IP", slog.String("ip", ip), slog.String("entry", entry))
+			logSpamAttempt(r, "Denied IP ("+entry+")", ip, nil)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+	}
+
+	if banTracker != nil {
+		_, done := traceCheck(r.Context(), "ban")
+		ban, banned := banTracker.IsBanned(ip)
+		done(banned)
+		if banned {
+			logger.Warn("Blocked request from banned IP", slog.String("ip", ip), slog.Time("until", ban.Until))
+			countAlertEvent(alertBanned)
+			logSpamAttempt(r, "Banned IP (until "+ban.Until.UTC().Format(time.RFC3339)+")", ip, nil)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+	}
+
+	// check the token that was injected by the form
+	formToken := r.FormValue("_ts_token")
+	_, done := traceCheck(r.Context(), "token")
+	validToken := token.Validate(tokenSecret, formToken, time.Now())
+	done(!validToken)
+	if !validToken {
+		logger.Warn("Invalid or missing timestamp token", slog.String("ip", ip))
+		countAlertEvent(alertTokenFailures)
+		recordSpamVerdict(r, "token", "Invalid token", scoreInvalidToken, ip)
+
+		http.Error(w, "Invalid token", http.StatusBadRequest)
+		return
+	}
+
+	// honeypot fields
+	_, done = traceCheck(r.Context(), "honeypot")
+	honeypot := honeypotTriggered(r)
+	done(honeypot)
+	if honeypot {
+		logger.Info("Honeypot field triggered — likely a bot", slog.String("ip", ip))
+		recordSpamVerdict(r, "honeypot", "Honeypot triggered", scoreHoneypot, ip)
+
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// CAPTCHA, if a provider is configured
+	var captcha *archive.Captcha
+	if captchaVerifier != nil {
+		ctx, done := traceCheck(r.Context(), "captcha")
+		var passed bool
+		captcha, passed = checkCaptcha(w, r.WithContext(ctx), ip)
+		done(!passed)
+		if !passed {
+			return
+		}
+	}
+
+	// real fields
+	name := r.FormValue("name")
+	email := r.FormValue("email")
+	message := r.FormValue("message")
+	subject := r.FormValue("subject")
+
+	// Debug logging to see what we're receiving
+	logger.Info("Form submission received",
+		slog.String("name", name),
+		slog.String("email", email),
+		slog.String("subject", subject),
+		slog.String("ip", ip))
+
+	if name == "" || email == "" || message == "" {
+		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		logger.Warn("Missing required fields", slog.String("ip", ip))
+		observeSubmission(r, OutcomeValidationError, "")
+		return
+	}
+
+	// duplicate submissions: double-clicks and resubmitted payloads
+	var dup DuplicateResult
+	if dupDetector != nil {
+		_, done := traceCheck(r.Context(), "duplicate")
+		dup = dupDetector.Check(email, subject, message, ip)
+		done(dup.Verdict != DuplicateNone)
+		switch dup.Verdict {
+		case DuplicateSuppressed:
+			// the first one may still be on its way; answer as it fares
+			if delivered, err := dupDetector.WaitDelivery(r.Context(), dup); err != nil || !delivered {
+				http.Error(w, "Failed to send message", http.StatusInternalServerError)
+				observeSubmission(r, OutcomeMailError, "")
+				return
+			}
+			logger.Info("Duplicate submission suppressed",
+				slog.String("fingerprint", dup.Fingerprint[:16]),
+				slog.Int("count", dup.Count),
+				slog.Int("distinct_ips", dup.DistinctIPs),
+				slog.Int64("total_suppressed", dup.Suppressed),
+				slog.String("ip", ip))
+			observeSubmission(r, OutcomeDuplicate, "")
+			writeSuccess(w, r)
+			return
+		case DuplicateSpam:
+			logger.Warn("Identical message from many IPs — likely a bot",
+				slog.String("fingerprint", dup.Fingerprint[:16]),
+				slog.Int("count", dup.Count),
+				slog.Int("distinct_ips", dup.DistinctIPs),
+				slog.Int64("total_duplicate_spam", dup.Spam),
+				slog.String("ip", ip))
+			recordSpamVerdict(r, "duplicate", "Duplicate message from "+strconv.Itoa(dup.DistinctIPs)+" IPs", scoreDuplicateSpam, ip)
+			writeSuccess(w, r)
+			return
+		}
+	}
+
+	// archive the accepted submission before attempting delivery
+	var archiveID string
+	if submissionArchive != nil {
+		id, err := submissionArchive.Store(archive.Submission{
+			ReceivedAt:     time.Now(),
+			FormID:         getFormID(r),
+			Name:           name,
+			Email:          email,
+			Subject:        subject,
+			Message:        message,
+			Fields:         submittedFields(r),
+			ClientIP:       ip,
+			UserAgent:      r.UserAgent(),
+			Origin:         r.Header.Get("Origin"),
+			Referer:        r.Referer(),
+			DeliveryStatus: archive.DeliveryPending,
+			Captcha:        captcha,
+		})
+		if err != nil {
+			logger.Error("Failed to archive submission", slog.String("error", err.Error()), slog.String("ip", ip))
+		}
+		archiveID = id
+	}
+
+	deliveriesInFlight.Add(1)
+	err := sendEmail(r.Context(), name, email, message, subject)
+	deliveriesInFlight.Add(-1)
+	if archiveID != "" {
+		status := archive.DeliveryDelivered
+		if err != nil {
+			status = archive.DeliveryFailed
+		}
+		if archiveErr := submissionArchive.SetDeliveryStatus(archiveID, status, err); archiveErr != nil {
+			logger.Error("Failed to update archived submission", slog.String("id", archiveID), slog.String("error", archiveErr.Error()))
+		}
+	}
+	if dup.Verdict == DuplicateNone && dupDetector != nil {
+		if err != nil {
+			dupDetector.Forget(dup)
+		} else {
+			dupDetector.Delivered(dup)
+		}
+	}
+	if err != nil {
+		http.Error(w, "Failed to send message", http.StatusInternalServerError)
+		logger.Error("Failed to send email", slog.String("error", err.Error()), slog.String("ip", ip))
+		observeSubmission(r, OutcomeMailError, "")
+		return
+	}
+
+	logger.Info("Email sent successfully", slog.String("name", name), slog.String("email", email), slog.String("ip", ip))
+	observeSubmission(r, OutcomeDelivered, "")
+	writeSuccess(w, r)
+}
+
+// writeSuccess sends the response for a delivered submission. Suppressed
+// duplicates get the same response so the visitor cannot tell the difference.
+func writeSuccess(w http.ResponseWriter, r *http.Request) {
+	if next := r.FormValue("_next"); next != "" {
+		http.Redirect(w, r, next, http.StatusSeeOther)
+	} else {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("Thanks! Your message was sent."))
+	}
+}
+
+// logSpamAttempt counts a rejected submission and records it in the spam
+// log, if enabled, with the scores of the checks that rejected it.
+func logSpamAttempt(r *http.Request, reason, ip string, scores map[string]float64) {
+	observeSubmission(r, OutcomeSpam, reason)
+	if os.Getenv("SPAM_LOG_ENABLED") != "true" || spamLogger == nil {
+		return
+	}
+
+	entry := spamlog.Entry{
+		SenderEmail: r.FormValue("email"),
+		Subject:     r.FormValue("subject"),
+		Message:     r.FormValue("message"),
+		Reason:      reason,
+		ClientIP:    ip,
+		RequestID:   requestID(r),
+		FormID:      getFormID(r),
+		UserAgent:   r.UserAgent(),
+		Origin:      r.Header.Get("Origin"),
+		Referer:     r.Referer(),
+		Scores:      scores,
+	}
+	if issued, ok := token.Issued(tokenSecret, r.FormValue("_ts_token")); ok {
+		seconds := int64(time.Since(issued) / time.Second)
+		entry.TimeToSubmit = &seconds
+	}
+	for name := range r.PostForm {
+		entry.Fields = append(entry.Fields, name)
+	}
+	sort.Strings(entry.Fields)
+
+	if err := spamLogger.Log(entry); err != nil {
+		logger.Error("Failed to log spam", slog.String("error", err.Error()))
+	}
+}
+
+// requestID identifies a request in logs: the X-Request-ID set by a proxy,
+// else the trace ID, else a random one.
+func requestID(r *http.Request) string {
+	if id := r.Header.Get("X-Request-ID"); id != "" {
+		return id
+	}
+	if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+		return sc.TraceID().String()
+	}
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Spam scores express how certain a verdict is, from 0 to 100. Verdicts
+// below QUARANTINE_THRESHOLD are kept in quarantine for review.
+const (
+	scoreInvalidToken   = 60 // also caused by visitors who left the page open
+	scoreCaptchaFailed  = 70
+	scoreCaptchaMissing = 80
+	scoreDuplicateSpam  = 85
+	scoreHoneypot       = 95
+)
+
+// recordSpamVerdict logs a submission that check classified as spam, keeps
+// it in quarantine if the verdict is borderline and counts it towards a
+// temporary ban of the sender's IP. Only verdicts count towards the spam
+// alert, so a banned sender's retries are not counted twice.
+func recordSpamVerdict(r *http.Request, check, reason string, score int, ip string) {
+	logSpamAttempt(r, reason, ip, map[string]float64{check: float64(score)})
+	countAlertEvent(alertSpam)
+	quarantineSubmission(r, reason, score, ip)
+	if banTracker == nil {
+		return
+	}
+	if ban, banned := banTracker.RecordSpam(ip, reason); banned {
+		logger.Warn("IP banned after repeated spam",
+			slog.String("ip", ban.IP),
+			slog.Int("offences", ban.Offences),
+			slog.Time("until", ban.Until),
+			slog.String("reason", reason))
+	}
+}
+
+// quarantineSubmission keeps the full submission for borderline verdicts so
+// that a misfiring heuristic does not lose a real message.
+func quarantineSubmission(r *http.Request, reason string, score int, ip string) {
+	if quarantineStore == nil || !quarantineStore.Borderline(score) || honeypotTriggered(r) {
+		return
+	}
+	// only complete submissions could have come from a real visitor
+	if r.FormValue("name") == "" || r.FormValue("email") == "" || r.FormValue("message") == "" {
+		return
+	}
+	id, err := quarantineStore.Add(QuarantineItem{
+		ReceivedAt: time.Now(),
+		FormID:     getFormID(r),
+		ClientIP:   ip,
+		Reason:     reason,
+		Score:      score,
+		Name:       r.FormValue("name"),
+		Email:      r.FormValue("email"),
+		Subject:    r.FormValue("subject"),
+		Message:    r.FormValue("message"),
+		Fields:     submittedFields(r),
+	})
+	if err != nil {
+		logger.Error("Failed to quarantine submission", slog.String("error", err.Error()))
+		return
+	}
+	logger.Info("Submission quarantined for review", slog.String("id", id), slog.Int("score", score), slog.String("reason", reason))
+}
+
+func honeypotTriggered(r *http.Request) bool {
+	return r.FormValue("_gotcha") != "" || r.FormValue("nickname") != ""
+}
+
+// credentialFields are posted with every form but only prove something once:
+// the form token and the response fields of the CAPTCHA providers.
+var credentialFields = map[string]bool{
+	"_ts_token":             true,
+	"cf-turnstile-response": true,
+	"h-captcha-response":    true,
+	"g-recaptcha-response":  true,
+	"frc-captcha-solution":  true,
+}
+
+// submittedFields returns the posted fields without credentialFields, for
+// keeping a submission on disk.
+func submittedFields(r *http.Request) map[string][]string {
+	fields := make(map[string][]string, len(r.PostForm))
+	for key, values := range r.PostForm {
+		if !credentialFields[key] {
+			fields[key] = values
+		}
+	}
+	return fields
+}
+
+// getFormID returns the form identifier from the endpoint path, e.g.
+// "contact" for /f/contact.
+func getFormID(r *http.Request) string {
+	return path.Base(r.URL.Path)
+}
+
+const defaultForms = "contact"
+
+// loadForms configures forms from FORMS, a comma-separated list of form IDs.
+// Only these are served, so a request cannot invent a form ID that ends up in
+// metric labels, per-form settings or the archive.
+func loadForms() error {
+	env := os.Getenv("FORMS")
+	if env == "" {
+		env = defaultForms
+	}
+	ids := make(map[string]bool)
+	for _, id := range strings.Split(env, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		if !validFormID(id) {
+			return fmt.Errorf("invalid FORMS entry %q, want letters, digits, - and _", id)
+		}
+		ids[id] = true
+	}
+	if len(ids) == 0 {
+		return fmt.Errorf("invalid FORMS %q: no forms", env)
+	}
+	forms = ids
+	return nil
+}
+
+func validFormID(id string) bool {
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return id != ""
+}
+
+// formHandler serves the forms configured in FORMS at /f/{form} and answers
+// 404 for any other form ID.
+func formHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !forms[r.PathValue("form")] {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkCaptcha verifies the provider's response field and writes the error
+// response itself when the submission must be rejected. For an accepted
+// submission it returns how it passed, to be kept in the archive.
+func checkCaptcha(w http.ResponseWriter, r *http.Request, ip string) (*archive.Captcha, bool) {
+	provider := captchaVerifier.Provider()
+	response := r.FormValue(captchaVerifier.ResponseField())
+	if response == "" {
+		logger.Warn("Missing CAPTCHA response", slog.String("provider", provider), slog.String("ip", ip))
+		recordSpamVerdict(r, "captcha", "CAPTCHA missing ("+provider+")", scoreCaptchaMissing, ip)
+		http.Error(w, "CAPTCHA verification failed", http.StatusBadRequest)
+		return nil, false
+	}
+
+	remoteIP := ip
+	if addr, ok := parseClientAddr(ip); ok {
+		remoteIP = addr.String()
+	}
+
+	result, err := captchaVerifier.Verify(r.Context(), response, remoteIP)
+	if err != nil {
+		formID := getFormID(r)
+		if captchaFailOpen(formID) {
+			logger.Warn("CAPTCHA provider unavailable, accepting submission (fail-open)",
+				slog.String("provider", provider),
+				slog.String("form", formID),
+				slog.String("error", err.Error()),
+				slog.String("ip", ip))
+			return &archive.Captcha{Provider: provider, Result: archive.CaptchaFailOpen, Error: err.Error()}, true
+		}
+		logger.Error("CAPTCHA provider unavailable, rejecting submission (fail-closed)",
+			slog.String("provider", provider),
+			slog.String("form", formID),
+			slog.String("error", err.Error()),
+			slog.String("ip", ip))
+		logSpamAttempt(r, "CAPTCHA unavailable ("+provider+"): "+err.Error(), ip, nil)
+		http.Error(w, "CAPTCHA verification unavailable", http.StatusServiceUnavailable)
+		return nil, false
+	}
+
+	if !result.Success {
+		codes := strings.Join(result.ErrorCodes, ",")
+		logger.Warn("CAPTCHA verification failed",
+			slog.String("provider", provider),
+			slog.String("errors", codes),
+			slog.String("ip", ip))
+		reason := "CAPTCHA failed (" + provider + ")"
+		if codes != "" {
+			reason += ": " + codes
+		}
+		score := scoreCaptchaFailed
+		if result.HasScore {
+			// reCAPTCHA v3: a low score means a likely bot
+			score = 100 - int(result.Score*100)
+		}
+		recordSpamVerdict(r, "captcha", reason, score, ip)
+		http.Error(w, "CAPTCHA verification failed", http.StatusBadRequest)
+		return nil, false
+	}
+
+	passed := &archive.Captcha{Provider: provider, Result: archive.CaptchaPassed, Hostname: result.Hostname}
+	attrs := []interface{}{slog.String("provider", provider), slog.String("hostname", result.Hostname), slog.String("ip", ip)}
+	if result.HasScore {
+		passed.Score = &result.Score
+		attrs = append(attrs, slog.Float64("score", result.Score))
+	}
+	logger.Info("CAPTCHA verification passed", attrs...)
+	return passed, true
+}
+
+func jsTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if ipFilter != nil {
+		if denied, entry := ipFilter.Check(getClientIP(r)); denied {
+			logger.Warn("Blocked token request from denied IP", slog.String("ip", getClientIP(r)), slog.String("entry", entry))
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+	}
+	if banTracker != nil {
+		if _, banned := banTracker.IsBanned(getClientIP(r)); banned {
+			countAlertEvent(alertBanned)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+	}
+
+	tok := token.Generate(tokenSecret, time.Now())
+	observeTokenIssued(r)
+
+	w.Header().Set("Content-Type", "application/javascript")
+	w.Header().Set("Cache-Control", "no-store")
+	script := fmt.Sprintf(`(function () {
+	const token = "%s";
+	const input = document.createElement("input");
+	input.type = "hidden";
+	input.name = "_ts_token";
+	input.value = token;
+	const forms = document.querySelectorAll("form");
+	forms.forEach(form => form.appendChild(input.cloneNode(true)));
+})();`, tok)
+	_, _ = w.Write([]byte(script))
+}
+
+func checkAndSetCORSHeaders(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	allowedOrigins := os.Getenv("CORS_ALLOW_ORIGINS")
+	if allowedOrigins == "" {
+		allowedOrigins = "*"
+	}
+
+	// Parse multiple allowed origins (comma-separated)
+	var isAllowed bool
+	if allowedOrigins == "*" {
+		isAllowed = true
+	} else if origin != "" {
+		origins := strings.Split(allowedOrigins, ",")
+		for _, allowedOrigin := range origins {
+			if strings.TrimSpace(allowedOrigin) == origin {
+				isAllowed = true
+				break
+			}
+		}
+	}
+
+	// Block request if origin is not allowed
+	if origin != "" && !isAllowed {
+		return false
+	}
+
+	if origin != "" && isAllowed {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Max-Age", "86400")
+	}
+	return true
+}
+
+// configure builds the enabled features from the environment. It starts no
+// background work, so check-config can use it on its own.
+func configure() error {
+	// Initialize spam logger if enabled
+	if os.Getenv("SPAM_LOG_ENABLED") == "true" {
+		spamLogger = spamlog.New()
+		logger.Info("Spam logging enabled", slog.String("dir", spamLogger.Dir()))
+	}
+
+	// Initialize CAPTCHA verification if a provider is configured
+	verifier, err := NewCaptchaVerifier()
+	if err != nil {
+		return fmt.Errorf("invalid CAPTCHA configuration: %w", err)
+	}
+	if verifier != nil {
+		captchaVerifier = verifier
+		logger.Info("CAPTCHA verification enabled", slog.String("provider", verifier.Provider()))
+	}
+
+	if err := loadForms(); err != nil {
+		return err
+	}
+
+	// Only believe forwarding headers from known reverse proxies
+	if err := loadTrustedProxies(); err != nil {
+		return err
+	}
+	if len(trustedProxies) > 0 {
+		logger.Info("Trusting forwarded client addresses", slog.Int("proxies", len(trustedProxies)))
+	}
+
+	// Initialize IP allow/deny lists if configured
+	filter, err := NewIPFilter()
+	if err != nil {
+		return fmt.Errorf("failed to load IP lists: %w", err)
+	}
+	ipFilter = filter
+
+	// Initialize automatic banning of repeat offenders if enabled
+	tracker, err := NewBanTracker()
+	if err != nil {
+		return fmt.Errorf("invalid ban configuration: %w", err)
+	}
+	if tracker != nil {
+		banTracker = tracker
+		logger.Info("Automatic banning enabled", slog.Int("threshold", tracker.threshold), slog.String("window", tracker.window.String()))
+	}
+
+	// Initialize duplicate-submission detection if enabled
+	detector, err := NewDuplicateDetector()
+	if err != nil {
+		return fmt.Errorf("invalid duplicate detection configuration: %w", err)
+	}
+	if detector != nil {
+		dupDetector = detector
+		logger.Info("Duplicate detection enabled", slog.String("window", detector.window.String()))
+	}
+
+	// Initialize quarantine of borderline spam verdicts if enabled
+	if os.Getenv("QUARANTINE_ENABLED") == "true" {
+		quarantineStore = NewQuarantineStore()
+		logger.Info("Quarantine enabled", slog.String("dir", quarantineStore.dir), slog.Int("threshold", quarantineStore.threshold))
+	}
+
+	// Initialize the submission archive if enabled
+	if os.Getenv("SUBMISSION_ARCHIVE_ENABLED") == "true" {
+		submissionArchive = archive.New()
+		logger.Info("Submission archive enabled", slog.String("path", submissionArchive.Path()), slog.Int("retention_days", submissionArchive.RetentionDays()))
+	}
+
+	// Initialize the built-in spam report schedule if configured
+	scheduler, err := report.NewSchedulerFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid spam report schedule: %w", err)
+	}
+	if scheduler != nil {
+		reportScheduler = scheduler
+		logger.Info("Spam report schedule enabled", slog.String("schedule", scheduler.Schedule()),
+			slog.String("timezone", scheduler.Location().String()), slog.String("period", scheduler.Period()))
+	}
+
+	// Initialize the submission digest schedule if configured
+	scheduler, err = report.NewDigestSchedulerFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid submission digest schedule: %w", err)
+	}
+	if scheduler != nil {
+		digestScheduler = scheduler
+		logger.Info("Submission digest schedule enabled", slog.String("schedule", scheduler.Schedule()),
+			slog.String("timezone", scheduler.Location().String()), slog.String("period", scheduler.Period()))
+	}
+
+	// Initialize spike alerting if enabled
+	a, err := NewAlerter()
+	if err != nil {
+		return fmt.Errorf("invalid alerting configuration: %w", err)
+	}
+	if a != nil {
+		alerter = a
+		logger.Info("Alerting enabled", slog.String("rules", strings.Join(a.Rules(), ",")), slog.String("cooldown", shortDuration(a.cooldown)))
+		if a.mailsOnly(alertDeliveryFailures) {
+			// the alert would go through the SMTP server that is failing
+			logger.Warn("Delivery failure alerts have no webhook in ALERT_OUTPUTS and may not arrive")
+		}
+	}
+
+	// a shared TOKEN_SECRET is needed when running more than one instance
+	secret, generated, err := token.SecretFromEnv()
+	if err != nil {
+		return err
+	}
+	tokenSecret = secret
+	if generated {
+		logger.Info("Generated ephemeral TOKEN_SECRET for this runtime")
+	}
+
+	// readiness checks for /readyz and /status
+	checker, err := NewHealthChecker()
+	if err != nil {
+		return fmt.Errorf("invalid readiness configuration: %w", err)
+	}
+	healthChecker = checker
+
+	listen, err := listenConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	logger.Info("Listener configured", slog.String("addr", listen.addr), slog.Bool("https", listen.https))
+	if listen.acme != nil {
+		logger.Info("ACME certificates enabled",
+			slog.String("domains", strings.Join(listen.acme.Domains, ",")),
+			slog.String("directory", listen.acme.DirectoryURL),
+			slog.String("cache_dir", listen.acme.CacheDir))
+	}
+	serverListen = listen
+
+	return nil
+}
+
+// listenConfig is the public listener. HTTP and HTTPS differ only in the
+// default port and the certificate.
+type listenConfig struct {
+	addr     string
+	https    bool
+	certFile string
+	keyFile  string
+	acme     *ACMEConfig // certificates from ACME instead of the files
+}
+
+// listenConfigFromEnv reads PORT and, with USE_HTTPS=true, SSL_CERT_PATH and
+// SSL_KEY_PATH. ACME_ENABLED=true implies HTTPS with managed certificates.
+func listenConfigFromEnv() (listenConfig, error) {
+	lc := listenConfig{https: os.Getenv("USE_HTTPS") == "true"}
+
+	acmeConfig, err := NewACMEConfig()
+	if err != nil {
+		return lc, err
+	}
+	if acmeConfig != nil {
+		if os.Getenv("SSL_CERT_PATH") != "" || os.Getenv("SSL_KEY_PATH") != "" {
+			return lc, errors.New("ACME_ENABLED and SSL_CERT_PATH/SSL_KEY_PATH are mutually exclusive")
+		}
+		lc.https = true
+		lc.acme = acmeConfig
+	}
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+		if lc.https {
+			port = "443"
+		}
+	}
+	lc.addr = ":" + port
+
+	if lc.https && lc.acme == nil {
+		lc.certFile = os.Getenv("SSL_CERT_PATH")
+		lc.keyFile = os.Getenv("SSL_KEY_PATH")
+		if lc.certFile == "" || lc.keyFile == "" {
+			return lc, errors.New("SSL_CERT_PATH and SSL_KEY_PATH are required when USE_HTTPS=true")
+		}
+	}
+	return lc, nil
+}
+
+// Serve runs the form server until it fails or receives SIGINT or SIGTERM,
+// and returns the process exit code.
+func Serve() int {
+	if err := configure(); err != nil {
+		logger.Error("Invalid configuration", slog.String("error", err.Error()))
+		return exitServeFailed
+	}
+
+	// background work: spam log sync and retention, list reloads, ban state
+	// sync, quarantine and archive retention, scheduled reports, alert
+	// evaluation
+	if spamLogger != nil {
+		spamLogger.Start(logger)
+	}
+	if ipFilter != nil {
+		ipFilter.Watch()
+	}
+	if banTracker != nil {
+		banTracker.Watch()
+	}
+	if quarantineStore != nil {
+		quarantineStore.RunRetention()
+	}
+	if submissionArchive != nil {
+		if err := submissionArchive.Open(); err != nil {
+			logger.Error("Failed to open submission archive", slog.String("error", err.Error()))
+			return exitServeFailed
+		}
+		submissionArchive.RunRetention(logger)
+	}
+	if reportScheduler != nil {
+		reportScheduler.Start(logger)
+	}
+	if digestScheduler != nil {
+		digestScheduler.Start(logger)
+	}
+	if alerter != nil {
+		alerter.Start()
+	}
+
+	// OpenTelemetry tracing, a no-op unless TRACING_ENABLED is set
+	shutdownTracing, err := setupTracing(context.Background())
+	if err != nil {
+		logger.Error("Invalid tracing configuration", slog.String("error", err.Error()))
+		return exitServeFailed
+	}
+	tracingShutdown = shutdownTracing
+
+	// /f/{form} is the Formspree-compatible POST endpoint of each form in FORMS
+	http.Handle("/f/{form}", formHandler(instrumentHandler("contact", traceHandler("/f/{form}", http.HandlerFunc(contactHandler)))))
+	// /form-token.js returns the anti-spam JavaScript for the form
+	http.Handle("/form-token.js", instrumentHandler("token", traceHandler("/form-token.js", http.HandlerFunc(jsTokenHandler))))
+	// /health endpoint for monitoring
+	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"status":"healthy","service":"hugo-contact","timestamp":"` + time.Now().Format(time.RFC3339) + `"}`))
+	})
+
+	// /livez and /readyz for probes, /status for humans
+	http.HandleFunc("/livez", livezHandler)
+	http.HandleFunc("/readyz", healthChecker.ReadyzHandler)
+	if os.Getenv("STATUS_PAGE_ENABLED") == "true" {
+		http.HandleFunc("/status", healthChecker.StatusHandler)
+	}
+
+	// Prometheus metrics, disabled unless METRICS_ENABLED or METRICS_LISTEN_ADDR is set
+	startMetrics()
+
+	// certificates and TLS settings of the form server, nil for plain HTTP
+	listen := serverListen
+	var serverTLS *tls.Config
+	if listen.https {
+		serverTLS, err = newTLSConfig()
+		if err != nil {
+			logger.Error("Invalid TLS configuration", slog.String("error", err.Error()))
+			return exitServeFailed
+		}
+	}
+	if listen.acme != nil {
+		servingACME = listen.acme
+		acmeTLS := listen.acme.Manager().TLSConfig()
+		acmeTLS.MinVersion = serverTLS.MinVersion
+		acmeTLS.CipherSuites = serverTLS.CipherSuites
+		serverTLS = acmeTLS
+		startACMEHTTP(listen.acme)
+	} else if listen.https {
+		store, err := NewCertStoreFromEnv()
+		if err != nil {
+			logger.Error("Invalid HTTPS certificate", slog.String("error", err.Error()))
+			return exitServeFailed
+		}
+		store.Watch()
+		servingCerts = store
+		serverTLS.GetCertificate = store.GetCertificate
+	}
+
+	// admin API, disabled unless ADMIN_LISTEN_ADDR or ADMIN_PATH_PREFIX is set
+	if err := startAdminAPI(serverTLS); err != nil {
+		logger.Error("Invalid admin API configuration", slog.String("error", err.Error()))
+		return exitServeFailed
+	}
+
+	server := &http.Server{
+		Addr:      listen.addr,
+		Handler:   http.DefaultServeMux,
+		TLSConfig: serverTLS,
+		ErrorLog: slog.NewLogLogger(
+			slog.NewJSONHandler(os.Stdout, nil),
+			slog.LevelError,
+		),
+	}
+	trackServer(server)
+
+	if listen.https {
+		cert := listen.certFile
+		if listen.acme != nil {
+			cert = "acme"
+		}
+		logger.Info("Starting HTTPS form handler", slog.String("addr", listen.addr), slog.String("cert", cert))
+		return serveUntilSignal(func() error {
+			return server.ListenAndServeTLS("", "")
+		})
+	}
+
+	logger.Info("Starting HTTP form handler", slog.String("addr", listen.addr))
+	return serveUntilSignal(server.ListenAndServe)
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFormHandler(t *testing.T) {
+	t.Setenv("FORMS", "contact, newsletter")
+	if err := loadForms(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { forms = nil })
+
+	mux := http.NewServeMux()
+	mux.Handle("/f/{form}", formHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(getFormID(r)))
+	})))
+
+	for path, want := range map[string]int{
+		"/f/contact":    http.StatusOK,
+		"/f/newsletter": http.StatusOK,
+		"/f/other":      http.StatusNotFound,
+		"/f/":           http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, nil))
+		if rec.Code != want {
+			t.Errorf("POST %s = %d, want %d", path, rec.Code, want)
+		}
+		if want == http.StatusOK && "/f/"+rec.Body.String() != path {
+			t.Errorf("POST %s: form ID %q", path, rec.Body.String())
+		}
+	}
+}
+
+func TestLoadForms(t *testing.T) {
+	t.Cleanup(func() { forms = nil })
+
+	t.Setenv("FORMS", "")
+	if err := loadForms(); err != nil || len(forms) != 1 || !forms["contact"] {
+		t.Errorf("default forms = %v, %v, want contact", forms, err)
+	}
+	for _, env := range []string{"contact,../admin", "con tact", " , "} {
+		t.Setenv("FORMS", env)
+		if err := loadForms(); err == nil {
+			t.Errorf("FORMS=%q accepted", env)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/report"
+)
+
+const defaultShutdownTimeout = 25 * time.Second
+
+// Exit codes of the server. Subcommands use 2 for usage errors.
+const (
+	exitClean        = 0
+	exitServeFailed  = 1
+	exitDrainTimeout = 3 // requests were still running at the deadline
+)
+
+// servers lists every listener that has to be drained on shutdown.
+var servers struct {
+	sync.Mutex
+	list []*http.Server
+}
+
+// trackServer registers a server for graceful shutdown.
+func trackServer(server *http.Server) {
+	servers.Lock()
+	defer servers.Unlock()
+
+	servers.list = append(servers.list, server)
+}
+
+// serveUntilSignal runs serve, which must block like ListenAndServe, until
+// it fails or SIGINT/SIGTERM arrives, then shuts down gracefully. It returns
+// the process exit code.
+func serveUntilSignal(serve func() error) int {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+
+	failed := make(chan error, 1)
+	go func() {
+		if err := serve(); !errors.Is(err, http.ErrServerClosed) {
+			failed <- err
+		}
+	}()
+
+	code := exitClean
+	select {
+	case err := <-failed:
+		logger.Error("Server failed", slog.String("error", err.Error()))
+		code = exitServeFailed
+	case sig := <-stop:
+		logger.Info("Shutting down", slog.String("signal", sig.String()))
+	}
+	signal.Stop(stop)
+
+	if drainCode := shutdown(); code == exitClean {
+		code = drainCode
+	}
+	return code
+}
+
+// shutdown stops accepting connections, waits up to SHUTDOWN_TIMEOUT for
+// in-flight requests, including SMTP deliveries, and then flushes state.
+func shutdown() int {
+	timeout := defaultShutdownTimeout
+	if env := os.Getenv("SHUTDOWN_TIMEOUT"); env != "" {
+		if d, err := time.ParseDuration(env); err == nil && d > 0 {
+			timeout = d
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	code := exitClean
+
+	servers.Lock()
+	list := servers.list
+	servers.Unlock()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for _, server := range list {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := server.Shutdown(ctx); err != nil {
+				logger.Error("Failed to drain listener",
+					slog.String("addr", server.Addr),
+					slog.String("error", err.Error()),
+					slog.Int64("deliveries_in_flight", deliveriesInFlight.Load()))
+				server.Close()
+				mu.Lock()
+				code = exitDrainTimeout
+				mu.Unlock()
+			}
+		}()
+	}
+	// scheduled reports finish a send in progress, so the spam log and
+	// archive they read stay open until then
+	for _, scheduler := range []*report.Scheduler{reportScheduler, digestScheduler} {
+		if scheduler == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := scheduler.Stop(ctx); err != nil {
+				logger.Error("Scheduled report still sending at shutdown", slog.String("error", err.Error()))
+			}
+		}()
+	}
+	wg.Wait()
+
+	// flush state with a fresh deadline, even if draining ran out of time
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+
+	if alerter != nil {
+		if err := alerter.Stop(flushCtx); err != nil {
+			logger.Error("Failed to send pending alerts", slog.String("error", err.Error()))
+		}
+	}
+	if spamLogger != nil {
+		if err := spamLogger.Close(); err != nil {
+			logger.Error("Failed to flush spam log", slog.String("error", err.Error()))
+		}
+	}
+	if submissionArchive != nil {
+		if err := submissionArchive.Close(); err != nil {
+			logger.Error("Failed to close submission archive", slog.String("error", err.Error()))
+		}
+	}
+	if banTracker != nil {
+		if err := banTracker.Close(); err != nil {
+			logger.Error("Failed to save ban state", slog.String("error", err.Error()))
+		}
+	}
+	if tracingShutdown != nil {
+		if err := tracingShutdown(flushCtx); err != nil {
+			logger.Error("Failed to flush traces", slog.String("error", err.Error()))
+		}
+	}
+
+	logger.Info("Shutdown complete", slog.Int("exit_code", code))
+	return code
+}
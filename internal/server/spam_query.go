@@ -0,0 +1,204 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/spamlog"
+	"git.caffsoft.dev/caffeinated/hugo-contact/internal/timearg"
+)
+
+// RunSpamCommand implements "hugo-contact spam".
+func RunSpamCommand(args []string) int {
+	usage := `usage: hugo-contact spam query [flags]
+
+Reads the spam log in SPAM_LOG_DIR, including rotated and compressed files.
+
+flags:
+  -since, -until   time range; dates (2006-01-02), RFC 3339 timestamps or
+                   durations before now (24h, 7d); -since defaults to 24h
+  -reason          reason contains
+  -ip              IP address or CIDR range
+  -domain          sender address domain, subdomains included
+  -text            sender address, subject or message contains
+  -group-by        count by reason, ip, subnet (/24, /64), domain or hour;
+                   comma-separated for several
+  -format          table (default), json, csv or ndjson
+  -limit           maximum number of rows`
+
+	if len(args) == 0 || args[0] != "query" {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("spam query", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintln(os.Stderr, usage) }
+	var filter spamlog.Filter
+	var since, until, ip, groupBy, format string
+	var limit int
+	fs.StringVar(&since, "since", "24h", "logged after")
+	fs.StringVar(&until, "until", "", "logged before")
+	fs.StringVar(&filter.Reason, "reason", "", "reason contains")
+	fs.StringVar(&ip, "ip", "", "IP address or CIDR range")
+	fs.StringVar(&filter.Domain, "domain", "", "sender address domain")
+	fs.StringVar(&filter.Text, "text", "", "sender address, subject or message contains")
+	fs.StringVar(&groupBy, "group-by", "", "count by reason, ip, subnet, domain or hour")
+	fs.StringVar(&format, "format", "table", "table, json, csv or ndjson")
+	fs.IntVar(&limit, "limit", 0, "maximum number of rows")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	var err error
+	if filter.Since, err = timearg.Parse(since); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if filter.Until, err = timearg.Parse(until); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if ip != "" {
+		if filter.IP, err = parseIPOrCIDR(ip); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+	switch format {
+	case "table", "json", "csv", "ndjson":
+	default:
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", format)
+		return 2
+	}
+
+	var dims []string
+	if groupBy != "" {
+		for _, dim := range strings.Split(groupBy, ",") {
+			dims = append(dims, strings.TrimSpace(dim))
+		}
+		// validate before reading the log
+		if _, err := spamlog.GroupBy(nil, dims...); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+
+	entries, err := spamlog.New().Query(filter)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if dims == nil {
+		// newest first, like the report and the admin API
+		for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+			entries[i], entries[j] = entries[j], entries[i]
+		}
+		if limit > 0 && len(entries) > limit {
+			entries = entries[:limit]
+		}
+		err = writeSpamEntries(os.Stdout, format, entries)
+	} else {
+		groups, _ := spamlog.GroupBy(entries, dims...)
+		if limit > 0 && len(groups) > limit {
+			groups = groups[:limit]
+		}
+		err = writeSpamGroups(os.Stdout, format, dims, groups)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func writeSpamEntries(w io.Writer, format string, entries []spamlog.Entry) error {
+	switch format {
+	case "json":
+		if entries == nil {
+			entries = []spamlog.Entry{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	case "ndjson":
+		enc := json.NewEncoder(w)
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "csv":
+		return spamlog.WriteCSV(w, entries)
+	}
+
+	if len(entries) == 0 {
+		fmt.Fprintln(w, "No spam attempts found")
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tREASON\tIP\tEMAIL\tSUBJECT")
+	for _, e := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", e.Timestamp.Local().Format("2006-01-02 15:04"),
+			truncateForTable(e.Reason, 40), e.ClientIP, e.SenderEmail, truncateForTable(e.Subject, 40))
+	}
+	return tw.Flush()
+}
+
+func writeSpamGroups(w io.Writer, format string, dims []string, groups []spamlog.Group) error {
+	switch format {
+	case "json", "ndjson":
+		rows := make([]map[string]any, len(groups))
+		for i, g := range groups {
+			row := map[string]any{"count": g.Count}
+			for j, dim := range dims {
+				row[dim] = g.Keys[j]
+			}
+			rows[i] = row
+		}
+		enc := json.NewEncoder(w)
+		if format == "json" {
+			enc.SetIndent("", "  ")
+			return enc.Encode(rows)
+		}
+		for _, row := range rows {
+			if err := enc.Encode(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "csv":
+		cw := csv.NewWriter(w)
+		_ = cw.Write(append(append([]string{}, dims...), "count"))
+		for _, g := range groups {
+			_ = cw.Write(append(append([]string{}, g.Keys...), strconv.Itoa(g.Count)))
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	if len(groups) == 0 {
+		fmt.Fprintln(w, "No spam attempts found")
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, dim := range dims {
+		fmt.Fprintf(tw, "%s\t", strings.ToUpper(dim))
+	}
+	fmt.Fprintln(tw, "COUNT")
+	for _, g := range groups {
+		for _, key := range g.Keys {
+			fmt.Fprintf(tw, "%s\t", truncateForTable(key, 50))
+		}
+		fmt.Fprintf(tw, "%d\n", g.Count)
+	}
+	return tw.Flush()
+}
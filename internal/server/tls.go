@@ -0,0 +1,268 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const defaultCertReloadInterval = time.Minute
+
+// servingCerts is set while the HTTPS listener uses certificate files, so
+// that the readiness check can look at the loaded certificates.
+var servingCerts *CertStore
+
+type certFiles struct {
+	cert, key string
+}
+
+// CertStore holds the certificates of an HTTPS listener, picks one by SNI
+// and swaps in renewed files without a restart. The first certificate is
+// served to clients that send no or an unknown server name.
+type CertStore struct {
+	mu       sync.RWMutex
+	files    []certFiles
+	certs    []*tls.Certificate
+	byName   map[string]*tls.Certificate
+	modTimes map[string]time.Time
+	name     string // for log messages
+}
+
+// NewCertStoreFromEnv loads SSL_CERT_PATH/SSL_KEY_PATH and the additional
+// pairs in SSL_EXTRA_CERTS, a comma-separated list of cert.pem:key.pem.
+func NewCertStoreFromEnv() (*CertStore, error) {
+	files := []certFiles{{os.Getenv("SSL_CERT_PATH"), os.Getenv("SSL_KEY_PATH")}}
+	for _, pair := range strings.Split(os.Getenv("SSL_EXTRA_CERTS"), ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		cert, key, ok := strings.Cut(pair, ":")
+		if !ok || cert == "" || key == "" {
+			return nil, fmt.Errorf("invalid SSL_EXTRA_CERTS entry %q, want cert.pem:key.pem", pair)
+		}
+		files = append(files, certFiles{cert, key})
+	}
+	return NewCertStore("server", files...)
+}
+
+// NewCertStore loads the given certificate and key files.
+func NewCertStore(name string, files ...certFiles) (*CertStore, error) {
+	s := &CertStore{files: files, name: name}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload reads all files again. If any pair fails to load, the certificates
+// in use are kept.
+func (s *CertStore) Reload() error {
+	var certs []*tls.Certificate
+	byName := make(map[string]*tls.Certificate)
+	modTimes := make(map[string]time.Time)
+
+	for _, f := range s.files {
+		cert, err := tls.LoadX509KeyPair(f.cert, f.key)
+		if err != nil {
+			return fmt.Errorf("failed to load %s: %w", f.cert, err)
+		}
+		certs = append(certs, &cert)
+
+		names := cert.Leaf.DNSNames
+		if len(names) == 0 && cert.Leaf.Subject.CommonName != "" {
+			names = []string{cert.Leaf.Subject.CommonName}
+		}
+		for _, name := range names {
+			name = strings.ToLower(name)
+			if _, dup := byName[name]; !dup {
+				byName[name] = &cert // earlier pairs win
+			}
+		}
+
+		for _, file := range []string{f.cert, f.key} {
+			if info, err := os.Stat(file); err == nil {
+				modTimes[file] = info.ModTime()
+			}
+		}
+	}
+
+	s.mu.Lock()
+	s.certs = certs
+	s.byName = byName
+	s.modTimes = modTimes
+	s.mu.Unlock()
+	return nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (s *CertStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if cert, ok := s.byName[name]; ok {
+		return cert, nil
+	}
+	if _, rest, ok := strings.Cut(name, "."); ok {
+		if cert, ok := s.byName["*."+rest]; ok {
+			return cert, nil
+		}
+	}
+	return s.certs[0], nil
+}
+
+// Leaves returns the parsed certificates in configuration order.
+func (s *CertStore) Leaves() []*x509.Certificate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	leaves := make([]*x509.Certificate, len(s.certs))
+	for i, cert := range s.certs {
+		leaves[i] = cert.Leaf
+	}
+	return leaves
+}
+
+// Watch reloads the certificates when a file changes, checking every
+// TLS_CERT_RELOAD_INTERVAL, and on SIGHUP.
+func (s *CertStore) Watch() {
+	interval := defaultCertReloadInterval
+	if env := os.Getenv("TLS_CERT_RELOAD_INTERVAL"); env != "" {
+		if d, err := time.ParseDuration(env); err == nil && d > 0 {
+			interval = d
+		}
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		for {
+			select {
+			case <-hup:
+			case <-ticker.C:
+				if !s.changed() {
+					continue
+				}
+			}
+			if err := s.Reload(); err != nil {
+				logger.Error("Failed to reload certificates", slog.String("listener", s.name), slog.String("error", err.Error()))
+				continue
+			}
+			logger.Info("Certificates reloaded", slog.String("listener", s.name), slog.Int("count", len(s.files)))
+		}
+	}()
+}
+
+func (s *CertStore) changed() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for file, modTime := range s.modTimes {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue // mid-replacement; try again next tick
+		}
+		if !info.ModTime().Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newTLSConfig returns the settings shared by all HTTPS listeners:
+// TLS_MIN_VERSION (1.2 or 1.3, default 1.2) and TLS_CIPHER_SUITES, a
+// comma-separated list of Go cipher suite names for TLS 1.2. TLS 1.3 suites
+// are not configurable.
+func newTLSConfig() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if env := os.Getenv("TLS_MIN_VERSION"); env != "" {
+		v, ok := tlsVersions[env]
+		if !ok {
+			return nil, fmt.Errorf("invalid TLS_MIN_VERSION %q, want 1.2 or 1.3", env)
+		}
+		cfg.MinVersion = v
+	}
+
+	if env := os.Getenv("TLS_CIPHER_SUITES"); env != "" {
+		known := make(map[string]uint16)
+		for _, suite := range tls.CipherSuites() {
+			known[suite.Name] = suite.ID
+		}
+		for _, name := range strings.Split(env, ",") {
+			name = strings.TrimSpace(name)
+			id, ok := known[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown or insecure cipher suite %q in TLS_CIPHER_SUITES", name)
+			}
+			cfg.CipherSuites = append(cfg.CipherSuites, id)
+		}
+	}
+
+	return cfg, nil
+}
+
+// newAdminTLSConfig returns the TLS settings of the admin listener, or nil
+// to serve it over plain HTTP. ADMIN_TLS_CERT_PATH and ADMIN_TLS_KEY_PATH
+// give it its own certificate; otherwise the form server's is used.
+// ADMIN_TLS_CLIENT_CA requires clients to present a certificate signed by
+// one of the CAs in that file.
+func newAdminTLSConfig(serverCert func(*tls.ClientHelloInfo) (*tls.Certificate, error)) (*tls.Config, *CertStore, error) {
+	certFile := os.Getenv("ADMIN_TLS_CERT_PATH")
+	keyFile := os.Getenv("ADMIN_TLS_KEY_PATH")
+	caFile := os.Getenv("ADMIN_TLS_CLIENT_CA")
+	if certFile == "" && keyFile == "" && caFile == "" {
+		return nil, nil, nil
+	}
+
+	cfg, err := newTLSConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var store *CertStore
+	switch {
+	case certFile != "" && keyFile != "":
+		store, err = NewCertStore("admin", certFiles{certFile, keyFile})
+		if err != nil {
+			return nil, nil, err
+		}
+		cfg.GetCertificate = store.GetCertificate
+	case certFile != "" || keyFile != "":
+		return nil, nil, errors.New("ADMIN_TLS_CERT_PATH and ADMIN_TLS_KEY_PATH must be set together")
+	case serverCert != nil:
+		cfg.GetCertificate = serverCert
+	default:
+		return nil, nil, errors.New("ADMIN_TLS_CLIENT_CA needs ADMIN_TLS_CERT_PATH/ADMIN_TLS_KEY_PATH or HTTPS on the form server")
+	}
+
+	if caFile != "" {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read ADMIN_TLS_CLIENT_CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, store, nil
+}
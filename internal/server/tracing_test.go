@@ -0,0 +1,243 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	testProviderOnce sync.Once
+	testProvider     *sdktrace.TracerProvider
+	testExporter     = tracetest.NewInMemoryExporter()
+)
+
+// recordSpans routes the package tracers to an in-memory exporter and
+// returns a function that flushes and returns the spans ended since. The
+// global provider can only be installed once per process.
+func recordSpans(t *testing.T) func() tracetest.SpanStubs {
+	t.Helper()
+	testProviderOnce.Do(func() {
+		provider, err := newTracerProvider(context.Background(), testExporter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testProvider = provider
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+	testExporter.Reset()
+
+	return func() tracetest.SpanStubs {
+		if err := testProvider.ForceFlush(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return testExporter.GetSpans()
+	}
+}
+
+func findSpan(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("no span %q", name)
+	return tracetest.SpanStub{}
+}
+
+func spanAttr(span tracetest.SpanStub, key string) attribute.Value {
+	for _, kv := range span.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTraceHandler(t *testing.T) {
+	spans := recordSpans(t)
+
+	handler := traceHandler("/f/{form}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, done := traceCheck(r.Context(), "honeypot")
+		done(true)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}))
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodPost, "/f/contact", nil)
+	req.Header.Set("User-Agent", "test-agent")
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	got := spans()
+	server := findSpan(t, got, "POST /f/{form}")
+	if server.SpanKind != trace.SpanKindServer {
+		t.Errorf("kind = %v, want server", server.SpanKind)
+	}
+	if id := server.SpanContext.TraceID().String(); id != traceID {
+		t.Errorf("trace ID = %s, want the one from traceparent", id)
+	}
+	for key, want := range map[string]string{
+		"http.request.method": "POST",
+		"http.route":          "/f/{form}",
+		"url.path":            "/f/contact",
+		"user_agent.original": "test-agent",
+	} {
+		if v := spanAttr(server, key).AsString(); v != want {
+			t.Errorf("%s = %q, want %q", key, v, want)
+		}
+	}
+	if v := spanAttr(server, "http.response.status_code").AsInt64(); v != http.StatusInternalServerError {
+		t.Errorf("http.response.status_code = %d, want 500", v)
+	}
+	if server.Status.Code != codes.Error {
+		t.Errorf("status = %v, want error", server.Status.Code)
+	}
+
+	check := findSpan(t, got, "check.honeypot")
+	if check.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Error("check span is not a child of the request span")
+	}
+	if !spanAttr(check, "spam.rejected").AsBool() {
+		t.Error("spam.rejected = false, want true")
+	}
+}
+
+func TestSendEmailSpans(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		dataErr bool
+	}{
+		{"delivered", false},
+		{"rejected", true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			spans := recordSpans(t)
+			startSMTPStub(t, tt.dataErr)
+
+			ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+			err := sendEmail(ctx, "Ann", "ann@example.com", "Hello", "")
+			parent.End()
+			if tt.dataErr != (err != nil) {
+				t.Fatalf("sendEmail: %v", err)
+			}
+
+			got := spans()
+			send := findSpan(t, got, "smtp.send")
+			if send.Parent.SpanID() != parent.SpanContext().SpanID() {
+				t.Error("smtp.send is not a child of the request span")
+			}
+			if send.SpanKind != trace.SpanKindClient {
+				t.Errorf("kind = %v, want client", send.SpanKind)
+			}
+			if v := spanAttr(send, "server.address").AsString(); v != "localhost" {
+				t.Errorf("server.address = %q, want localhost", v)
+			}
+			for _, name := range []string{"email.render", "smtp.dial", "smtp.auth", "smtp.data"} {
+				if span := findSpan(t, got, name); span.Parent.SpanID() != send.SpanContext.SpanID() {
+					t.Errorf("%s is not a child of smtp.send", name)
+				}
+			}
+
+			wantStatus := codes.Unset
+			if tt.dataErr {
+				wantStatus = codes.Error
+			}
+			if send.Status.Code != wantStatus {
+				t.Errorf("smtp.send status = %v, want %v", send.Status.Code, wantStatus)
+			}
+			if data := findSpan(t, got, "smtp.data"); data.Status.Code != wantStatus {
+				t.Errorf("smtp.data status = %v, want %v", data.Status.Code, wantStatus)
+			}
+		})
+	}
+}
+
+// startSMTPStub runs a minimal SMTP server on localhost and points the SMTP_*
+// variables at it. With rejectData the message is refused after DATA.
+func startSMTPStub(t *testing.T, rejectData bool) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	t.Setenv("SMTP_HOST", "localhost")
+	t.Setenv("SMTP_PORT", port)
+	t.Setenv("SMTP_USERNAME", "user")
+	t.Setenv("SMTP_PASSWORD", "secret")
+	t.Setenv("SENDER_EMAIL", "form@example.com")
+	t.Setenv("RECIPIENT_EMAIL", "owner@example.com")
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTPStub(conn, rejectData)
+		}
+	}()
+}
+
+func serveSMTPStub(conn net.Conn, rejectData bool) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+
+	reply("220 localhost ESMTP stub")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"):
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case strings.HasPrefix(cmd, "AUTH"):
+			reply("235 2.7.0 Authentication successful")
+		case strings.HasPrefix(cmd, "MAIL"), strings.HasPrefix(cmd, "RCPT"):
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+			}
+			if rejectData {
+				reply("554 5.7.1 Message rejected")
+			} else {
+				reply("250 OK")
+			}
+		case cmd == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
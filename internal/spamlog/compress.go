@@ -0,0 +1,135 @@
+package spamlog
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression algorithms for finished segments.
+const (
+	CompressNone = "none"
+	CompressGzip = "gzip"
+	CompressZstd = "zstd"
+)
+
+var compressionSuffix = map[string]string{
+	CompressGzip: ".gz",
+	CompressZstd: ".zst",
+}
+
+// splitCompression removes a known compression suffix from name and returns
+// the algorithm, CompressNone for plain files.
+func splitCompression(name string) (string, string) {
+	for algo, suffix := range compressionSuffix {
+		if base, ok := strings.CutSuffix(name, suffix); ok {
+			return base, algo
+		}
+	}
+	return name, CompressNone
+}
+
+// openSegment opens a segment for reading, decompressing if needed. A plain
+// segment that was compressed since it was listed is found under its new
+// name.
+func openSegment(seg segment) (io.ReadCloser, error) {
+	file, err := os.Open(seg.path)
+	if errors.Is(err, os.ErrNotExist) && seg.compression == CompressNone {
+		for algo, suffix := range compressionSuffix {
+			if file, err = os.Open(seg.path + suffix); err == nil {
+				seg.compression = algo
+				break
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch seg.compression {
+	case CompressGzip:
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return readCloser{zr, func() error { zr.Close(); return file.Close() }}, nil
+	case CompressZstd:
+		zr, err := zstd.NewReader(file, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return readCloser{zr, func() error { zr.Close(); return file.Close() }}, nil
+	default:
+		return file, nil
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (rc readCloser) Close() error { return rc.close() }
+
+// compressSegment writes a compressed copy of a plain segment next to it and
+// removes the original. Readers skip the copy until the original is gone, so
+// no entry is seen twice.
+func compressSegment(seg segment, algo string) error {
+	target := seg.path + compressionSuffix[algo]
+	tmp := target + ".tmp"
+
+	src, err := os.Open(seg.path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp) // no-op after the rename
+
+	var w io.WriteCloser
+	switch algo {
+	case CompressGzip:
+		w = gzip.NewWriter(dst)
+	case CompressZstd:
+		if w, err = zstd.NewWriter(dst, zstd.WithEncoderConcurrency(1)); err != nil {
+			dst.Close()
+			return err
+		}
+	default:
+		dst.Close()
+		return fmt.Errorf("unknown compression %q", algo)
+	}
+
+	if _, err := io.Copy(w, src); err != nil {
+		w.Close()
+		dst.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, target); err != nil {
+		return err
+	}
+	return os.Remove(seg.path)
+}
@@ -0,0 +1,117 @@
+package spamlog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadCompressedSegments(t *testing.T) {
+	dir := t.TempDir()
+	writeSegment(t, dir, "spam-2026-03-08.jsonl", day(8), "gzip 1", "gzip 2")
+	writeSegment(t, dir, "spam-2026-03-09.jsonl.1773050000", day(9), "zstd")
+	writeSegment(t, dir, "spam-2026-03-09.jsonl", day(9).Add(time.Hour), "plain")
+	for name, algo := range map[string]string{
+		"spam-2026-03-08.jsonl":            CompressGzip,
+		"spam-2026-03-09.jsonl.1773050000": CompressZstd,
+	} {
+		seg, _ := parseSegment(filepath.Join(dir, name))
+		if err := compressSegment(seg, algo); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"spam-2026-03-08.jsonl.gz", "spam-2026-03-09.jsonl", "spam-2026-03-09.jsonl.1773050000.zst"}
+	if got := files(t, dir); !equal(got, want) {
+		t.Fatalf("files = %v, want %v", got, want)
+	}
+
+	sl := &Logger{logDir: dir}
+	if got := reasons(t, sl, time.Time{}); !equal(got, []string{"gzip 1", "gzip 2", "zstd", "plain"}) {
+		t.Errorf("Each = %v", got)
+	}
+	entries, err := sl.Query(Filter{Reason: "zstd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Reason != "zstd" {
+		t.Errorf("Query = %v, want the zstd entry", entries)
+	}
+}
+
+func TestSkipCompressedCopyInProgress(t *testing.T) {
+	dir := t.TempDir()
+	writeSegment(t, dir, "spam-2026-03-08.jsonl", day(8), "once")
+	// a copy left behind while the original still exists
+	writeSegment(t, dir, "spam-2026-03-08.jsonl.gz", day(8), "twice")
+
+	sl := &Logger{logDir: dir}
+	if got := reasons(t, sl, time.Time{}); !equal(got, []string{"once"}) {
+		t.Errorf("Each = %v, want the entry once", got)
+	}
+}
+
+func TestCompressFinished(t *testing.T) {
+	now := day(9).Add(12 * time.Hour)
+	sl := newTestLogger(t, &now)
+	sl.compression = CompressZstd
+	defer sl.Close()
+
+	writeSegment(t, sl.logDir, "spam-2026-03-08.jsonl", day(8), "yesterday")
+	writeSegment(t, sl.logDir, "spam-2026-03-09.jsonl.1773050000", day(9), "rotated")
+	if err := sl.Log(Entry{Reason: "live"}); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := sl.compressFinished(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"spam-2026-03-08.jsonl.zst", "spam-2026-03-09.jsonl", "spam-2026-03-09.jsonl.1773050000.zst"}
+	if got := files(t, sl.logDir); n != 2 || !equal(got, want) {
+		t.Errorf("compressed %d, files = %v, want 2 and %v", n, got, want)
+	}
+	if got := reasons(t, sl, time.Time{}); !equal(got, []string{"yesterday", "rotated", "live"}) {
+		t.Errorf("Each = %v", got)
+	}
+}
+
+func TestDiskBudget(t *testing.T) {
+	now := day(9).Add(12 * time.Hour)
+	sl := newTestLogger(t, &now)
+	defer sl.Close()
+
+	// four segments of about 100 KB within the retention period
+	big := strings.Repeat("x", 100*1024)
+	for _, name := range []string{
+		"spam-2026-03-06.jsonl.gz",
+		"spam-2026-03-07.jsonl",
+		"spam-2026-03-08.jsonl.zst",
+		"spam-2026-03-09.jsonl",
+	} {
+		if err := os.WriteFile(filepath.Join(sl.logDir, name), []byte(big), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sl.maxTotalBytes = 250 * 1024
+
+	removed, err := sl.cleanOldLogs(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"spam-2026-03-08.jsonl.zst", "spam-2026-03-09.jsonl"}
+	if got := files(t, sl.logDir); removed != 2 || !equal(got, want) {
+		t.Errorf("removed %d, files = %v, want 2 and %v", removed, got, want)
+	}
+
+	// the live file stays even when it alone is over the budget
+	sl.maxTotalBytes = 1
+	if _, err := sl.cleanOldLogs(now); err != nil {
+		t.Fatal(err)
+	}
+	if got := files(t, sl.logDir); !equal(got, []string{"spam-2026-03-09.jsonl"}) {
+		t.Errorf("files = %v, want only the live file", got)
+	}
+}
@@ -0,0 +1,204 @@
+package spamlog
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Filter selects entries. Zero fields match everything.
+type Filter struct {
+	Since  time.Time // after
+	Until  time.Time // before
+	Reason string    // reason contains, case-insensitive
+	IP     netip.Prefix
+	Domain string // sender address is at this domain or a subdomain
+	Text   string // sender address, subject or message contains, case-insensitive
+}
+
+// Match reports whether e passes the filter.
+func (f Filter) Match(e Entry) bool {
+	if !f.Since.IsZero() && !e.Timestamp.After(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Timestamp.Before(f.Until) {
+		return false
+	}
+	if f.Reason != "" && !containsFold(e.Reason, f.Reason) {
+		return false
+	}
+	if f.IP.IsValid() {
+		addr, ok := e.Addr()
+		if !ok || !f.IP.Contains(addr) {
+			return false
+		}
+	}
+	if f.Domain != "" {
+		domain, want := e.Domain(), strings.ToLower(strings.TrimPrefix(f.Domain, "@"))
+		if domain != want && !strings.HasSuffix(domain, "."+want) {
+			return false
+		}
+	}
+	if f.Text != "" {
+		if !containsFold(e.SenderEmail, f.Text) &&
+			!containsFold(e.Subject, f.Text) &&
+			!containsFold(e.Message, f.Text) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsFold reports whether the logged field contains substr, ignoring
+// case. Fields are HTML-escaped when logged, so a search for "<a href" or
+// "Tom & Jerry" compares against the text as submitted.
+func containsFold(field, substr string) bool {
+	return strings.Contains(strings.ToLower(html.UnescapeString(field)), strings.ToLower(substr))
+}
+
+// Query returns the entries matching f, oldest first.
+func (sl *Logger) Query(f Filter) ([]Entry, error) {
+	var entries []Entry
+	err := sl.Each(f.Since, func(e Entry) error {
+		if f.Match(e) {
+			entries = append(entries, e)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// Addr returns the client address without the port that entries logged
+// from RemoteAddr carry.
+func (e Entry) Addr() (netip.Addr, bool) {
+	host := strings.TrimSpace(e.ClientIP)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// Domain returns the lower-cased domain of the sender address.
+func (e Entry) Domain() string {
+	at := strings.LastIndex(e.SenderEmail, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(e.SenderEmail[at+1:])
+}
+
+// WriteCSV writes entries as CSV with a header row.
+func WriteCSV(w io.Writer, entries []Entry) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"timestamp", "reason", "client_ip", "sender_email", "subject", "message",
+		"request_id", "form_id", "user_agent", "origin", "referer"})
+	for _, e := range entries {
+		_ = cw.Write([]string{e.Timestamp.Format(time.RFC3339), e.Reason, e.ClientIP, e.SenderEmail, e.Subject,
+			e.Message, e.RequestID, e.FormID, e.UserAgent, e.Origin, e.Referer})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Dimensions to group entries by.
+const (
+	ByReason = "reason"
+	ByIP     = "ip"
+	BySubnet = "subnet" // /24 for IPv4, /64 for IPv6
+	ByDomain = "domain"
+	ByHour   = "hour" // local time
+)
+
+// Dimensions lists the valid arguments of GroupBy.
+var Dimensions = []string{ByReason, ByIP, BySubnet, ByDomain, ByHour}
+
+// Group is the number of entries sharing the same value in each dimension.
+type Group struct {
+	Keys  []string
+	Count int
+}
+
+// GroupBy counts entries by the given dimensions. Groups are ordered by
+// count, highest first, or chronologically when grouping by hour alone.
+func GroupBy(entries []Entry, dims ...string) ([]Group, error) {
+	for _, dim := range dims {
+		if !isDimension(dim) {
+			return nil, fmt.Errorf("unknown group %q, want one of %s", dim, strings.Join(Dimensions, ", "))
+		}
+	}
+
+	index := make(map[string]int)
+	var groups []Group
+	for _, e := range entries {
+		keys := make([]string, len(dims))
+		for i, dim := range dims {
+			keys[i] = groupKey(e, dim)
+		}
+		id := strings.Join(keys, "\x00")
+		if i, ok := index[id]; ok {
+			groups[i].Count++
+			continue
+		}
+		index[id] = len(groups)
+		groups = append(groups, Group{Keys: keys, Count: 1})
+	}
+
+	if len(dims) == 1 && dims[0] == ByHour {
+		sort.Slice(groups, func(i, j int) bool { return groups[i].Keys[0] < groups[j].Keys[0] })
+		return groups, nil
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return strings.Join(groups[i].Keys, " ") < strings.Join(groups[j].Keys, " ")
+	})
+	return groups, nil
+}
+
+func isDimension(dim string) bool {
+	for _, d := range Dimensions {
+		if d == dim {
+			return true
+		}
+	}
+	return false
+}
+
+func groupKey(e Entry, dim string) string {
+	switch dim {
+	case ByReason:
+		return e.Reason
+	case ByIP:
+		if addr, ok := e.Addr(); ok {
+			return addr.String()
+		}
+		return e.ClientIP
+	case BySubnet:
+		addr, ok := e.Addr()
+		if !ok {
+			return e.ClientIP
+		}
+		bits := 64
+		if addr.Is4() {
+			bits = 24
+		}
+		prefix, _ := addr.Prefix(bits)
+		return prefix.String()
+	case ByDomain:
+		return e.Domain()
+	case ByHour:
+		return e.Timestamp.Local().Format("2006-01-02 15:00")
+	}
+	return ""
+}
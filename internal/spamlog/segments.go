@@ -0,0 +1,182 @@
+package spamlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// segment is one spam log file.
+type segment struct {
+	path        string
+	day         string // 2006-01-02
+	seq         int64  // rotation time; the live file of a day sorts last
+	compression string
+}
+
+// parseSegment recognises spam-YYYY-MM-DD.jsonl and its rotated form
+// spam-YYYY-MM-DD.jsonl.<unix time>, both optionally compressed.
+func parseSegment(path string) (segment, bool) {
+	name, compression := splitCompression(filepath.Base(path))
+	rest, ok := strings.CutPrefix(name, "spam-")
+	if !ok || len(rest) < len("2006-01-02.jsonl") {
+		return segment{}, false
+	}
+	day := rest[:10]
+	if _, err := time.Parse("2006-01-02", day); err != nil {
+		return segment{}, false
+	}
+	rest, ok = strings.CutPrefix(rest[10:], ".jsonl")
+	if !ok {
+		return segment{}, false
+	}
+
+	seg := segment{path: path, day: day, seq: math.MaxInt64, compression: compression}
+	if rest == "" {
+		return seg, true
+	}
+	seq, err := strconv.ParseInt(strings.TrimPrefix(rest, "."), 10, 64)
+	if err != nil || !strings.HasPrefix(rest, ".") {
+		return segment{}, false
+	}
+	seg.seq = seq
+	return seg, true
+}
+
+// segments lists the log files in the order they were written.
+func (sl *Logger) segments() ([]segment, error) {
+	files, err := filepath.Glob(filepath.Join(sl.logDir, "spam-*.jsonl*"))
+	if err != nil {
+		return nil, err
+	}
+
+	plain := make(map[string]bool)
+	var segments []segment
+	for _, file := range files {
+		if seg, ok := parseSegment(file); ok {
+			segments = append(segments, seg)
+			if seg.compression == CompressNone {
+				plain[seg.path] = true
+			}
+		}
+	}
+
+	// a compressed copy whose original still exists is being written
+	kept := segments[:0]
+	for _, seg := range segments {
+		if seg.compression != CompressNone {
+			if base, _ := splitCompression(seg.path); plain[base] {
+				continue
+			}
+		}
+		kept = append(kept, seg)
+	}
+	segments = kept
+
+	sort.Slice(segments, func(i, j int) bool {
+		if segments[i].day != segments[j].day {
+			return segments[i].day < segments[j].day
+		}
+		return segments[i].seq < segments[j].seq
+	})
+	return segments, nil
+}
+
+// Each calls fn for every entry logged after since, oldest first, across
+// all segments. It stops at the first error fn returns.
+func (sl *Logger) Each(since time.Time, fn func(Entry) error) error {
+	// make buffered entries visible to the reader
+	sl.mu.Lock()
+	if sl.w != nil {
+		if err := sl.w.Flush(); err != nil {
+			sl.mu.Unlock()
+			return err
+		}
+	}
+	sl.mu.Unlock()
+
+	segments, err := sl.segments()
+	if err != nil {
+		return err
+	}
+
+	// files are named by local date, like time.Now() when they were written
+	sinceDay := since.Local().Format("2006-01-02")
+	for _, seg := range segments {
+		if seg.day < sinceDay {
+			continue
+		}
+		err := readSegment(seg, func(entry Entry) error {
+			if entry.Timestamp.After(since) {
+				return fn(entry)
+			}
+			return nil
+		})
+		if errors.Is(err, os.ErrNotExist) {
+			continue // rotated or removed since listing
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Recent returns the entries of the last hours, most recent first.
+func (sl *Logger) Recent(hours int) ([]Entry, error) {
+	cutoff := time.Now().Add(-time.Duration(hours) * time.Hour)
+
+	var entries []Entry
+	err := sl.Each(cutoff, func(entry Entry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.After(entries[j].Timestamp)
+	})
+	return entries, nil
+}
+
+// readSegment decodes one file line by line, skipping malformed lines such
+// as a partial last line after a crash.
+func readSegment(seg segment, fn func(Entry) error) error {
+	file, err := openSegment(seg)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			var entry Entry
+			if json.Unmarshal(line, &entry) == nil {
+				if entry.SchemaVersion == 0 {
+					entry.SchemaVersion = 1
+				}
+				if ferr := fn(entry); ferr != nil {
+					return ferr
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package spamlog
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// day returns midnight of the given day of March 2026 in the local zone,
+// which segment files are named by.
+func day(d int) time.Time {
+	return time.Date(2026, 3, d, 0, 0, 0, 0, time.Local)
+}
+
+// writeSegment writes one plain segment with an entry per reason, an hour
+// apart from start.
+func writeSegment(t *testing.T, dir, name string, start time.Time, reasons ...string) {
+	t.Helper()
+	var data []byte
+	for i, reason := range reasons {
+		line, err := json.Marshal(Entry{
+			SchemaVersion: SchemaVersion,
+			Timestamp:     start.Add(time.Duration(i) * time.Hour),
+			Reason:        reason,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// reasons returns the reasons of the entries Each reports after since.
+func reasons(t *testing.T, sl *Logger, since time.Time) []string {
+	t.Helper()
+	var got []string
+	err := sl.Each(since, func(e Entry) error {
+		got = append(got, e.Reason)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestEachReadsSegmentsInOrder(t *testing.T) {
+	dir := t.TempDir()
+	// two rotations on the 9th, named by the second they happened in; 100
+	// sorts after 20 by number, not by name
+	writeSegment(t, dir, "spam-2026-03-09.jsonl.20", day(9).Add(1*time.Hour), "a", "b")
+	writeSegment(t, dir, "spam-2026-03-09.jsonl.100", day(9).Add(3*time.Hour), "c")
+	writeSegment(t, dir, "spam-2026-03-09.jsonl", day(9).Add(4*time.Hour), "d", "e")
+	writeSegment(t, dir, "spam-2026-03-08.jsonl", day(8).Add(23*time.Hour), "z")
+	writeSegment(t, dir, "spam-2026-03-10.jsonl", day(10), "f")
+	// not segments
+	writeSegment(t, dir, "spam-2026-03-09.jsonl.tmp", day(9), "x")
+	writeSegment(t, dir, "notes.jsonl", day(9), "x")
+
+	sl := &Logger{logDir: dir}
+	want := []string{"z", "a", "b", "c", "d", "e", "f"}
+	if got := reasons(t, sl, time.Time{}); !equal(got, want) {
+		t.Errorf("Each = %v, want %v", got, want)
+	}
+
+	// since skips earlier days and entries
+	want = []string{"b", "c", "d", "e", "f"}
+	if got := reasons(t, sl, day(9).Add(90*time.Minute)); !equal(got, want) {
+		t.Errorf("Each since 01:30 = %v, want %v", got, want)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestReadSchemaVersions(t *testing.T) {
+	dir := t.TempDir()
+	// a version 1 line as written before request metadata existed, then
+	// version 2 lines as Log writes them
+	v1 := `{"timestamp":"2026-03-09T08:00:00Z","sender_email":"a@spam.example","subject":"Hi","message":"Buy","reason":"honeypot","client_ip":"203.0.113.7"}`
+	if err := os.WriteFile(filepath.Join(dir, "spam-2026-03-09.jsonl"), []byte(v1+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	now := day(9).Add(12 * time.Hour)
+	sl := &Logger{logDir: dir, maxSizeMB: 1, now: func() time.Time { return now }, rotated: make(chan struct{}, 1)}
+	seconds := int64(4)
+	err := sl.Log(Entry{
+		SenderEmail:  "b@spam.example",
+		Reason:       "too fast",
+		ClientIP:     "198.51.100.23",
+		RequestID:    "req-1",
+		FormID:       "contact",
+		UserAgent:    "curl/8.0",
+		Origin:       "https://example.com",
+		Referer:      "https://example.com/contact/",
+		TimeToSubmit: &seconds,
+		Fields:       []string{"message", "email", "name"},
+		Scores:       map[string]float64{"timing": 90},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sl.Close()
+
+	var got []Entry
+	if err := sl.Each(time.Time{}, func(e Entry) error {
+		got = append(got, e)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("read %d entries, want 2", len(got))
+	}
+
+	old := got[0]
+	if old.SchemaVersion != 1 || old.Reason != "honeypot" || old.ClientIP != "203.0.113.7" {
+		t.Errorf("version 1 entry = %+v", old)
+	}
+	if old.FormID != "" || old.TimeToSubmit != nil || old.Fields != nil || old.Scores != nil {
+		t.Errorf("version 1 entry has metadata: %+v", old)
+	}
+
+	cur := got[1]
+	if cur.SchemaVersion != SchemaVersion || !cur.Timestamp.Equal(now) {
+		t.Errorf("version 2 entry: version %d at %s", cur.SchemaVersion, cur.Timestamp)
+	}
+	if cur.RequestID != "req-1" || cur.FormID != "contact" || cur.UserAgent != "curl/8.0" ||
+		cur.Origin != "https://example.com" || cur.Referer != "https://example.com/contact/" {
+		t.Errorf("version 2 request metadata = %+v", cur)
+	}
+	if cur.TimeToSubmit == nil || *cur.TimeToSubmit != 4 {
+		t.Errorf("time to submit = %v, want 4", cur.TimeToSubmit)
+	}
+	if !equal(cur.Fields, []string{"email", "message", "name"}) {
+		t.Errorf("fields = %v, want them sorted", cur.Fields)
+	}
+	if cur.Scores["timing"] != 90 {
+		t.Errorf("scores = %v", cur.Scores)
+	}
+}
@@ -0,0 +1,531 @@
+// Package spamlog writes rejected submissions to daily JSON Lines files and
+// reads them back for reports.
+//
+// The file of the current day is spam-YYYY-MM-DD.jsonl. When it reaches the
+// size limit it is renamed to spam-YYYY-MM-DD.jsonl.<unix time> and a new
+// one is started; readers see all segments of a day in the order written.
+// Finished segments may be compressed with gzip (.gz) or zstd (.zst) in the
+// background, which readers handle transparently.
+package spamlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxSubjectLength    = 200
+	maxEmailLength      = 100
+	maxMessageLength    = 500
+	maxHeaderLength     = 300 // User-Agent, Origin, Referer
+	maxNameLength       = 100 // form ID, request ID, field and check names
+	maxFields           = 50
+	maxLogSizeMB        = 10
+	defaultLogDir       = "/var/log/hugo-contact"
+	defaultSyncInterval = time.Second
+	cleanupInterval     = time.Hour
+)
+
+// SchemaVersion is the version of Entry written by this package. Lines
+// without schema_version are version 1, which has no request metadata.
+const SchemaVersion = 2
+
+// Entry is one rejected submission, sanitised for display.
+type Entry struct {
+	SchemaVersion int       `json:"schema_version"`
+	Timestamp     time.Time `json:"timestamp"`
+	SenderEmail   string    `json:"sender_email"`
+	Subject       string    `json:"subject"`
+	Message       string    `json:"message"`
+	Reason        string    `json:"reason"`
+	ClientIP      string    `json:"client_ip"`
+
+	// request metadata, since version 2
+	RequestID string `json:"request_id,omitempty"`
+	FormID    string `json:"form_id,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+	Origin    string `json:"origin,omitempty"`
+	Referer   string `json:"referer,omitempty"`
+	// TimeToSubmit is the seconds from loading the form to posting it,
+	// known only for submissions with a genuine token.
+	TimeToSubmit *int64 `json:"time_to_submit_seconds,omitempty"`
+	// Fields are the names of the submitted form fields, sorted.
+	Fields []string `json:"fields,omitempty"`
+	// Scores are the verdicts that led to rejection, by check, from 0 to
+	// 100.
+	Scores map[string]float64 `json:"scores,omitempty"`
+}
+
+// Logger appends entries to the segment of the current day in its
+// directory. It keeps the file open and buffers writes; Start syncs them to
+// disk periodically and Close flushes the rest.
+type Logger struct {
+	mu            sync.Mutex
+	logDir        string
+	maxSizeMB     int
+	retentionDays int
+	maxTotalBytes int64 // 0 for no disk budget
+	compression   string
+	syncInterval  time.Duration
+	now           func() time.Time
+	closed        bool
+
+	file    *os.File
+	w       *bufio.Writer
+	day     string // date of file, 2006-01-02
+	size    int64
+	dirty   bool // written since the last sync
+	started bool
+	stop    chan struct{}
+	done    chan struct{}
+	rotated chan struct{} // wakes the background work after a rotation
+}
+
+// New returns a logger configured from SPAM_LOG_DIR, SPAM_LOG_MAX_SIZE_MB,
+// SPAM_LOG_RETENTION_DAYS, SPAM_LOG_MAX_TOTAL_MB, SPAM_LOG_COMPRESS and
+// SPAM_LOG_SYNC_INTERVAL. It opens no file until the first entry is logged,
+// so it can be used to read the logs only.
+func New() *Logger {
+	logDir := os.Getenv("SPAM_LOG_DIR")
+	if logDir == "" {
+		logDir = defaultLogDir
+	}
+
+	maxSizeMB := maxLogSizeMB
+	if envSize := os.Getenv("SPAM_LOG_MAX_SIZE_MB"); envSize != "" {
+		if size, err := strconv.Atoi(envSize); err == nil && size > 0 {
+			maxSizeMB = size
+		}
+	}
+
+	retentionDays := 10 // Changed from 30 to 10 as requested
+	if envDays := os.Getenv("SPAM_LOG_RETENTION_DAYS"); envDays != "" {
+		if days, err := strconv.Atoi(envDays); err == nil && days > 0 {
+			retentionDays = days
+		}
+	}
+
+	var maxTotalBytes int64
+	if env := os.Getenv("SPAM_LOG_MAX_TOTAL_MB"); env != "" {
+		if size, err := strconv.Atoi(env); err == nil && size > 0 {
+			maxTotalBytes = int64(size) * 1024 * 1024
+		}
+	}
+
+	compression := CompressNone
+	if env := strings.ToLower(os.Getenv("SPAM_LOG_COMPRESS")); env != "" {
+		if _, ok := compressionSuffix[env]; ok {
+			compression = env
+		}
+	}
+
+	syncInterval := defaultSyncInterval
+	if env := os.Getenv("SPAM_LOG_SYNC_INTERVAL"); env != "" {
+		if d, err := time.ParseDuration(env); err == nil && d > 0 {
+			syncInterval = d
+		}
+	}
+
+	return &Logger{
+		logDir:        logDir,
+		maxSizeMB:     maxSizeMB,
+		retentionDays: retentionDays,
+		maxTotalBytes: maxTotalBytes,
+		compression:   compression,
+		syncInterval:  syncInterval,
+		now:           time.Now,
+		rotated:       make(chan struct{}, 1),
+	}
+}
+
+func (sl *Logger) sanitizeString(input string, maxLength int) string {
+	// HTML escape to prevent injection
+	sanitized := html.EscapeString(input)
+
+	// Remove any control characters
+	sanitized = strings.Map(func(r rune) rune {
+		if r < 32 && r != '\t' && r != '\n' {
+			return -1
+		}
+		return r
+	}, sanitized)
+
+	// Truncate to max length
+	if len(sanitized) > maxLength {
+		sanitized = sanitized[:maxLength]
+	}
+
+	return strings.TrimSpace(sanitized)
+}
+
+// Log sanitises and appends one entry, setting its time and schema version.
+func (sl *Logger) Log(e Entry) error {
+	entry := Entry{
+		SchemaVersion: SchemaVersion,
+		Timestamp:     sl.now(),
+		SenderEmail:   sl.sanitizeString(e.SenderEmail, maxEmailLength),
+		Subject:       sl.sanitizeString(e.Subject, maxSubjectLength),
+		Message:       sl.sanitizeString(e.Message, maxMessageLength),
+		Reason:        sl.sanitizeString(e.Reason, 100),
+		ClientIP:      sl.sanitizeString(e.ClientIP, 50),
+		RequestID:     sl.sanitizeString(e.RequestID, maxNameLength),
+		FormID:        sl.sanitizeString(e.FormID, maxNameLength),
+		UserAgent:     sl.sanitizeString(e.UserAgent, maxHeaderLength),
+		Origin:        sl.sanitizeString(e.Origin, maxHeaderLength),
+		Referer:       sl.sanitizeString(e.Referer, maxHeaderLength),
+		TimeToSubmit:  e.TimeToSubmit,
+	}
+	for i, name := range e.Fields {
+		if i == maxFields {
+			break
+		}
+		entry.Fields = append(entry.Fields, sl.sanitizeString(name, maxNameLength))
+	}
+	sort.Strings(entry.Fields)
+	if len(e.Scores) > 0 {
+		entry.Scores = make(map[string]float64, len(e.Scores))
+		for check, score := range e.Scores {
+			entry.Scores[sl.sanitizeString(check, maxNameLength)] = score
+		}
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode log entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	if sl.closed {
+		return fmt.Errorf("spam logger is closed")
+	}
+
+	if err := sl.prepare(entry.Timestamp, int64(len(line))); err != nil {
+		return err
+	}
+
+	if _, err := sl.w.Write(line); err != nil {
+		return fmt.Errorf("failed to write log entry: %w", err)
+	}
+	sl.size += int64(len(line))
+	sl.dirty = true
+
+	// without the background sync every entry goes straight to the file
+	if !sl.started {
+		return sl.w.Flush()
+	}
+	return nil
+}
+
+// prepare makes sure the open file is the one for now and has room for n
+// more bytes, starting a new day or rotating as needed.
+func (sl *Logger) prepare(now time.Time, n int64) error {
+	day := now.Format("2006-01-02")
+	if sl.file != nil && sl.day != day {
+		if err := sl.closeFile(); err != nil {
+			return err
+		}
+	}
+
+	maxSize := int64(sl.maxSizeMB) * 1024 * 1024
+	if sl.file == nil {
+		defer sl.wakeMaintenance() // a segment may have been finished
+		if err := sl.openFile(day); err != nil {
+			return err
+		}
+	}
+
+	// also a file reopened after a restart, which may have little room left
+	if sl.size > 0 && sl.size+n > maxSize {
+		if err := sl.closeFile(); err != nil {
+			return err
+		}
+		if err := sl.rotate(sl.currentPath(day), now); err != nil {
+			return fmt.Errorf("failed to rotate log: %w", err)
+		}
+		if err := sl.openFile(day); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sl *Logger) openFile(day string) error {
+	// Ensure log directory exists
+	if err := os.MkdirAll(sl.logDir, 0755); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	file, err := os.OpenFile(sl.currentPath(day), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	sl.file = file
+	sl.w = bufio.NewWriter(file)
+	sl.day = day
+	sl.size = info.Size()
+	return nil
+}
+
+// closeFile flushes, syncs and closes the open file.
+func (sl *Logger) closeFile() error {
+	if sl.file == nil {
+		return nil
+	}
+	err := sl.sync()
+	if cerr := sl.file.Close(); err == nil {
+		err = cerr
+	}
+	sl.file, sl.w = nil, nil
+	return err
+}
+
+func (sl *Logger) wakeMaintenance() {
+	select {
+	case sl.rotated <- struct{}{}:
+	default:
+	}
+}
+
+func (sl *Logger) sync() error {
+	if sl.file == nil || !sl.dirty {
+		return nil
+	}
+	if err := sl.w.Flush(); err != nil {
+		return err
+	}
+	if err := sl.file.Sync(); err != nil {
+		return err
+	}
+	sl.dirty = false
+	return nil
+}
+
+func (sl *Logger) currentPath(day string) string {
+	return filepath.Join(sl.logDir, fmt.Sprintf("spam-%s.jsonl", day))
+}
+
+// rotate renames a full day file by adding the time, made unique if the
+// previous rotation happened within the same second, even if that segment
+// has been compressed already.
+func (sl *Logger) rotate(path string, now time.Time) error {
+	ts := now.Unix()
+	for ; ; ts++ {
+		rotated := fmt.Sprintf("%s.%d", path, ts)
+		taken := exists(rotated)
+		for _, suffix := range compressionSuffix {
+			taken = taken || exists(rotated+suffix) || exists(rotated+suffix+".tmp")
+		}
+		if !taken {
+			return os.Rename(path, rotated)
+		}
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return !os.IsNotExist(err)
+}
+
+// Start launches the background ticker that syncs buffered entries to disk
+// every SPAM_LOG_SYNC_INTERVAL and, once an hour and after each rotation,
+// compresses finished segments and removes those outside the retention
+// period or the disk budget. Errors are reported to log.
+func (sl *Logger) Start(log *slog.Logger) {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	if sl.started || sl.closed {
+		return
+	}
+	sl.started = true
+	sl.stop = make(chan struct{})
+	sl.done = make(chan struct{})
+
+	go func() {
+		defer close(sl.done)
+
+		ticker := time.NewTicker(sl.syncInterval)
+		defer ticker.Stop()
+
+		var lastMaintenance time.Time
+		for {
+			if now := sl.now(); now.Sub(lastMaintenance) >= cleanupInterval {
+				sl.maintain(now, log)
+				lastMaintenance = now
+			}
+
+			select {
+			case <-sl.stop:
+				return
+			case <-sl.rotated:
+				sl.maintain(sl.now(), log)
+				continue
+			case <-ticker.C:
+			}
+
+			sl.mu.Lock()
+			err := sl.sync()
+			sl.mu.Unlock()
+			if err != nil {
+				log.Error("Failed to sync spam log", slog.String("error", err.Error()))
+			}
+		}
+	}()
+}
+
+func (sl *Logger) maintain(now time.Time, log *slog.Logger) {
+	if compressed, err := sl.compressFinished(now); err != nil {
+		log.Error("Failed to compress spam log", slog.String("error", err.Error()))
+	} else if compressed > 0 {
+		log.Info("Compressed spam logs", slog.Int("files", compressed), slog.String("compression", sl.compression))
+	}
+
+	if removed, err := sl.cleanOldLogs(now); err != nil {
+		log.Error("Failed to remove old spam logs", slog.String("error", err.Error()))
+	} else if removed > 0 {
+		log.Info("Removed old spam logs", slog.Int("files", removed))
+	}
+}
+
+// live reports whether seg is the file entries are appended to now.
+func live(seg segment, now time.Time) bool {
+	return seg.seq == math.MaxInt64 && seg.compression == CompressNone && seg.day == now.Format("2006-01-02")
+}
+
+// compressFinished compresses the plain segments that receive no more
+// entries: rotated ones and those of past days.
+func (sl *Logger) compressFinished(now time.Time) (int, error) {
+	if sl.compression == CompressNone {
+		return 0, nil
+	}
+
+	// release yesterday's file if nothing was logged since midnight
+	sl.mu.Lock()
+	var err error
+	if sl.file != nil && sl.day != now.Format("2006-01-02") {
+		err = sl.closeFile()
+	}
+	sl.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	segments, err := sl.segments()
+	if err != nil {
+		return 0, err
+	}
+
+	compressed := 0
+	for _, seg := range segments {
+		if seg.compression != CompressNone || live(seg, now) {
+			continue
+		}
+		if err := compressSegment(seg, sl.compression); err != nil {
+			return compressed, fmt.Errorf("%s: %w", filepath.Base(seg.path), err)
+		}
+		compressed++
+	}
+	return compressed, nil
+}
+
+// cleanOldLogs removes the segments of days before the retention period,
+// then the oldest ones until the total fits SPAM_LOG_MAX_TOTAL_MB. The live
+// file is never removed.
+func (sl *Logger) cleanOldLogs(now time.Time) (int, error) {
+	segments, err := sl.segments()
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := now.AddDate(0, 0, -sl.retentionDays).Format("2006-01-02")
+	sizes := make([]int64, len(segments))
+	var total int64
+	for i, seg := range segments {
+		if info, err := os.Stat(seg.path); err == nil {
+			sizes[i] = info.Size()
+			total += sizes[i]
+		}
+	}
+
+	removed := 0
+	for i, seg := range segments {
+		overBudget := sl.maxTotalBytes > 0 && total > sl.maxTotalBytes
+		if seg.day >= cutoff && !overBudget {
+			break // segments are oldest first
+		}
+		if live(seg, now) {
+			continue
+		}
+		if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		total -= sizes[i]
+		removed++
+	}
+	return removed, nil
+}
+
+// Close stops the background ticker, waits for a write in progress, syncs
+// the current log file to disk and rejects further entries.
+func (sl *Logger) Close() error {
+	sl.mu.Lock()
+	if sl.closed {
+		sl.mu.Unlock()
+		return nil
+	}
+	sl.closed = true
+	started := sl.started
+	sl.mu.Unlock()
+
+	if started {
+		close(sl.stop)
+		<-sl.done
+	}
+
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	return sl.closeFile()
+}
+
+// DiskUsage returns the combined size of all spam log files, rotated ones included.
+func (sl *Logger) DiskUsage() (int64, error) {
+	segments, err := sl.segments()
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, seg := range segments {
+		info, err := os.Stat(seg.path)
+		if err != nil {
+			continue
+		}
+		total += info.Size()
+	}
+	return total, nil
+}
+
+// Dir returns the log directory.
+func (sl *Logger) Dir() string {
+	return sl.logDir
+}
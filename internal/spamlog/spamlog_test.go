@@ -0,0 +1,123 @@
+package spamlog
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestLogger returns a logger writing to a temporary directory whose
+// clock only moves when the test sets it.
+func newTestLogger(t *testing.T, now *time.Time) *Logger {
+	t.Helper()
+	return &Logger{
+		logDir:        t.TempDir(),
+		maxSizeMB:     1,
+		retentionDays: 10,
+		compression:   CompressNone,
+		syncInterval:  time.Hour,
+		now:           func() time.Time { return *now },
+		rotated:       make(chan struct{}, 1),
+	}
+}
+
+// files lists the names in dir, sorted.
+func files(t *testing.T, dir string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, m := range matches {
+		names = append(names, filepath.Base(m))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRotateBySize(t *testing.T) {
+	now := day(9).Add(12 * time.Hour)
+	sl := newTestLogger(t, &now)
+	defer sl.Close()
+
+	// a file left just short of the limit by an earlier run
+	live := filepath.Join(sl.logDir, "spam-2026-03-09.jsonl")
+	writeSegment(t, sl.logDir, "spam-2026-03-09.jsonl", day(9), "earlier")
+	f, err := os.OpenFile(live, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, _ := f.Stat()
+	f.Write([]byte(strings.Repeat(" ", 1024*1024-int(info.Size())-10) + "\n"))
+	f.Close()
+
+	if err := sl.Log(Entry{Reason: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Second)
+	if err := sl.Log(Entry{Reason: "second"}); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := "spam-2026-03-09.jsonl." + strconv.FormatInt(day(9).Add(12*time.Hour).Unix(), 10)
+	want := []string{"spam-2026-03-09.jsonl", rotated}
+	if got := files(t, sl.logDir); !equal(got, want) {
+		t.Fatalf("files = %v, want %v", got, want)
+	}
+	if got := reasons(t, sl, time.Time{}); !equal(got, []string{"earlier", "first", "second"}) {
+		t.Errorf("Each = %v, want earlier, first, second", got)
+	}
+}
+
+func TestRotateByDay(t *testing.T) {
+	now := day(9).Add(23*time.Hour + 59*time.Minute)
+	sl := newTestLogger(t, &now)
+	defer sl.Close()
+
+	if err := sl.Log(Entry{Reason: "before midnight"}); err != nil {
+		t.Fatal(err)
+	}
+	now = day(10).Add(time.Minute)
+	if err := sl.Log(Entry{Reason: "after midnight"}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"spam-2026-03-09.jsonl", "spam-2026-03-10.jsonl"}
+	if got := files(t, sl.logDir); !equal(got, want) {
+		t.Fatalf("files = %v, want %v", got, want)
+	}
+	if got := reasons(t, sl, day(10)); !equal(got, []string{"after midnight"}) {
+		t.Errorf("Each since the 10th = %v, want only the entry after midnight", got)
+	}
+}
+
+func TestRetentionOnTicker(t *testing.T) {
+	now := day(20).Add(12 * time.Hour)
+	sl := newTestLogger(t, &now)
+
+	// the retention is 10 days, so the 10th is the oldest day kept
+	writeSegment(t, sl.logDir, "spam-2026-03-05.jsonl", day(5), "old")
+	writeSegment(t, sl.logDir, "spam-2026-03-09.jsonl.1773050000", day(9), "old rotated")
+	writeSegment(t, sl.logDir, "spam-2026-03-10.jsonl", day(10), "kept")
+	writeSegment(t, sl.logDir, "spam-2026-03-20.jsonl", day(20), "today")
+
+	sl.Start(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	want := []string{"spam-2026-03-10.jsonl", "spam-2026-03-20.jsonl"}
+	deadline := time.Now().Add(5 * time.Second)
+	for !equal(files(t, sl.logDir), want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("files = %v, want %v", files(t, sl.logDir), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := sl.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
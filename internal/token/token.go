@@ -0,0 +1,85 @@
+// Package token issues and checks the timestamp tokens that the form script
+// injects, so that submissions from bots that never loaded the page or post
+// instantly can be rejected.
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A token is accepted once it is MinAge old and until it is MaxAge old.
+const (
+	MinAge = 2 * time.Second
+	MaxAge = 15 * time.Minute
+)
+
+// SecretFromEnv returns TOKEN_SECRET, which must be shared by all instances
+// behind a load balancer. Without it a random secret is generated and
+// generated reports true.
+func SecretFromEnv() (secret []byte, generated bool, err error) {
+	if env := os.Getenv("TOKEN_SECRET"); env != "" {
+		if len(env) < 16 {
+			return nil, false, errors.New("TOKEN_SECRET must be at least 16 bytes")
+		}
+		return []byte(env), false, nil
+	}
+
+	secret = make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, false, fmt.Errorf("failed to generate random token secret: %w", err)
+	}
+	return secret, true, nil
+}
+
+// Generate returns a token for the given issue time.
+func Generate(secret []byte, issued time.Time) string {
+	ts := strconv.FormatInt(issued.Unix(), 10)
+	return ts + ":" + sign(secret, ts)
+}
+
+// Validate reports whether token was issued with secret between MaxAge and
+// MinAge before now.
+func Validate(secret []byte, token string, now time.Time) bool {
+	issued, ok := Issued(secret, token)
+	if !ok {
+		return false
+	}
+
+	age := now.Unix() - issued.Unix()
+	if issued.After(now) || age < int64(MinAge/time.Second) || age > int64(MaxAge/time.Second) {
+		return false // too new or too old
+	}
+	return true
+}
+
+// Issued returns the issue time of a token signed with secret, whatever its
+// age.
+func Issued(secret []byte, token string) (time.Time, bool) {
+	parts := strings.SplitN(token, ":", 2)
+	if len(parts) != 2 {
+		return time.Time{}, false
+	}
+	ts, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if !hmac.Equal([]byte(sign(secret, parts[0])), []byte(parts[1])) {
+		return time.Time{}, false
+	}
+	return time.Unix(ts, 0), true
+}
+
+func sign(secret []byte, ts string) string {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(ts))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
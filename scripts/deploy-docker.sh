@@ -53,9 +53,9 @@ build_image() {
     cd "$DEPLOY_DIR"
     
     # Check if required files exist
-    if [ ! -f "Dockerfile" ] || [ ! -f "main-https.go" ] || [ ! -f "spam_logger.go" ] || [ ! -f "go.mod" ]; then
+    if [ ! -f "Dockerfile" ] || [ ! -f "main.go" ] || [ ! -d "internal" ] || [ ! -f "go.mod" ]; then
         print_error "Required build files not found in $DEPLOY_DIR"
-        print_warning "Please upload: Dockerfile, main-https.go, spam_logger.go, go.mod, go.sum"
+        print_warning "Please upload: Dockerfile, main.go, internal/, cmd/, go.mod, go.sum"
         exit 1
     fi
     
@@ -123,6 +123,7 @@ run_container() {
     docker run -d \
         --name "$CONTAINER_NAME" \
         --restart unless-stopped \
+        --stop-timeout 30 \
         -p 8080:8080 \
         $VOLUME_ARGS \
         -e PORT=8080 \
@@ -195,7 +196,8 @@ cleanup_files() {
     print_status "Cleaning up build files..."
     
     cd "$DEPLOY_DIR"
-    rm -f Dockerfile main-https.go go.mod go.sum
+    rm -f Dockerfile *.go go.mod go.sum
+    rm -rf internal cmd
     
     print_status "Build files removed for security"
 }
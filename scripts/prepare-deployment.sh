@@ -48,8 +48,8 @@ copy_files() {
     print_status "Copying deployment files..."
     
     # Check if source files exist
-    if [ ! -f "$PROJECT_ROOT/main-https.go" ]; then
-        print_error "main-https.go not found in project root!"
+    if [ ! -f "$PROJECT_ROOT/main.go" ] || [ ! -d "$PROJECT_ROOT/internal" ]; then
+        print_error "main.go or internal/ not found in project root!"
         exit 1
     fi
     
@@ -64,8 +64,8 @@ copy_files() {
     fi
     
     # Copy files
-    cp "$PROJECT_ROOT/main-https.go" "$DEPLOY_PACKAGE_DIR/"
-    cp "$PROJECT_ROOT/spam_logger.go" "$DEPLOY_PACKAGE_DIR/"
+    cp "$PROJECT_ROOT/main.go" "$DEPLOY_PACKAGE_DIR/"
+    cp -r "$PROJECT_ROOT/internal" "$DEPLOY_PACKAGE_DIR/"
     cp "$PROJECT_ROOT/Dockerfile" "$DEPLOY_PACKAGE_DIR/"
     cp "$PROJECT_ROOT/go.mod" "$DEPLOY_PACKAGE_DIR/"
     
@@ -110,11 +110,11 @@ HUGO CONTACT FORM - DEPLOYMENT INSTRUCTIONS
 
    Files to upload:
    - Dockerfile
-   - main-https.go
-   - spam_logger.go
+   - main.go
+   - internal/ (directory with the application packages)
    - go.mod
    - go.sum
-   - cmd/ (directory with spam report tool)
+   - cmd/ (directory with the legacy spam-report wrapper)
    - scripts/ (directory with cron script)
    - deploy-docker.sh (optional - for automated deployment)
 
@@ -163,7 +163,7 @@ RewriteRule ^(.*)$ http://localhost:8080/$1 [P,L]
 HTACCESS
 
    # Clean up build files
-   rm -f Dockerfile main-https.go go.mod go.sum deploy-docker.sh
+   rm -rf Dockerfile main.go internal cmd go.mod go.sum deploy-docker.sh
 
 5. TEST THE DEPLOYMENT
    curl http://localhost:8080/health
@@ -30,22 +30,22 @@ if [ "$SPAM_REPORT_ENABLED" != "true" ]; then
 fi
 
 # Check if running inside Docker container or on host
-if [ -f "/app/bin/spam-report" ]; then
+if [ -f "/app/hugo-contact" ]; then
     # Running inside Docker container
-    SPAM_REPORT_BINARY="/app/bin/spam-report"
+    HUGO_CONTACT_BINARY="/app/hugo-contact"
 else
     # Running on host - build if needed
-    SPAM_REPORT_BINARY="$PROJECT_DIR/bin/spam-report"
-    if [ ! -f "$SPAM_REPORT_BINARY" ]; then
-        echo "[$(date '+%Y-%m-%d %H:%M:%S')] Building spam report tool..."
+    HUGO_CONTACT_BINARY="$PROJECT_DIR/bin/hugo-contact"
+    if [ ! -f "$HUGO_CONTACT_BINARY" ]; then
+        echo "[$(date '+%Y-%m-%d %H:%M:%S')] Building hugo-contact..."
         cd "$PROJECT_DIR"
-        go build -o "$SPAM_REPORT_BINARY" ./cmd/spam-report/main.go
+        go build -o "$HUGO_CONTACT_BINARY" .
     fi
 fi
 
 # Run the spam report generator
-if [ -f "$SPAM_REPORT_BINARY" ]; then
-    "$SPAM_REPORT_BINARY"
+if [ -f "$HUGO_CONTACT_BINARY" ]; then
+    "$HUGO_CONTACT_BINARY" spam-report "$@"
     EXIT_CODE=$?
     
     if [ $EXIT_CODE -eq 0 ]; then
@@ -55,7 +55,7 @@ if [ -f "$SPAM_REPORT_BINARY" ]; then
         exit $EXIT_CODE
     fi
 else
-    echo "[$(date '+%Y-%m-%d %H:%M:%S')] Error: Spam report binary not found at $SPAM_REPORT_BINARY"
+    echo "[$(date '+%Y-%m-%d %H:%M:%S')] Error: hugo-contact binary not found at $HUGO_CONTACT_BINARY"
     exit 1
 fi
 